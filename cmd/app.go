@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// App owns a command tree, its options and its input and output. Each Execute parses args into fresh copies
+// of the options, so that an App can execute several times, and Apps can execute in parallel : RunE leaves
+// find their options in their ctx (see OptionsFrom, IsDryRun). Run leaves, reading options without ctx, are
+// executed one at a time.
+// Package level functions (Setup, Run, OptionFrom...) use a default App, parsing into registered options.
+type App struct {
+	Root   *Command
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	isolated bool       // options are copied at each execution
+	err      *XbeeError // error when adding completion commands to Root
+}
+
+// NewApp creates an App running commands of root, with process stdin, stdout and stderr. The tree of root
+// must not change afterwards.
+func NewApp(root *Command) *App {
+	return &App{
+		Root:     root,
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		isolated: true,
+		err:      addBuiltinCommands(root),
+	}
+}
+
+var defaultApp = &App{Root: &root, Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+
+// current is the last execution parsed by the default App, or the Run leaf being executed by an App.
+var current *execution
+
+// legacyLock serializes Run leaves of Apps : they read their options through current.
+var legacyLock sync.Mutex
+
+// Execute runs the command found in args, args not containing the program name. Flags starting with --xbee
+// are removed first. In help mode, the usage of the command is displayed instead.
+func (a *App) Execute(ctx context.Context, args []string) *XbeeError {
+	xbeeFlags, args := filterValuesOption(args)
+	e, err := a.parse(args)
+	if err != nil {
+		return err
+	}
+	e.xbeeFlags = xbeeFlags
+	if e.leaf == nil {
+		return UsageError("unknown command %s", strings.Join(args, " "))
+	}
+	if e.isHelp || e.options.Get("help").BooleanValue() {
+		usage, err := e.leaf.Usage()
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(a.Stdout, usage)
+		return nil
+	}
+	return e.run(ctx)
+}
+
+// execution holds what was parsed for one Execute.
+type execution struct {
+	app       *App
+	leaf      *Command
+	realArgs  []string
+	isHelp    bool
+	options   *Options
+	xbeeFlags []string
+	planned   plan            // side effects planned in dry run
+	ctx       context.Context // set once running
+}
+
+func (a *App) parse(args []string) (*execution, *XbeeError) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	e := &execution{app: a, options: &Options{global: a.globalOptions()}}
+	if len(args) > 0 && args[0] == completeCommandName {
+		// words to complete are not parsed
+		e.leaf, e.realArgs = a.Root.commands[completeCommandName], args[1:]
+		return e, nil
+	}
+	if len(args) > 0 && args[0] == "help" {
+		e.isHelp = true
+		args = args[1:]
+	}
+	leaf, realArgs, leafOptions, err := a.findRunnable(a.Root, args, e.options.global)
+	if err != nil {
+		return e, err
+	}
+	e.leaf, e.realArgs, e.options.leaf = leaf, realArgs, optionMap(leafOptions)
+	options := leafOptions
+	for _, option := range e.options.global {
+		options = append(options, option)
+	}
+	if err := bindOptions(options, a.Root.knownOptions(e.options.global), a.Stderr, UserConfigFile(), ProjectConfigFile()); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// globalOptions returns registered global options, copied if the App is isolated.
+func (a *App) globalOptions() map[string]*Option {
+	if !a.isolated {
+		return globalOptions
+	}
+	result := make(map[string]*Option, len(globalOptions))
+	for name, option := range globalOptions {
+		result[name] = option.clone()
+	}
+	return result
+}
+
+func (a *App) findRunnable(c *Command, args []string, globals map[string]*Option) (*Command, []string, []*Option, *XbeeError) {
+	if c.passThrough {
+		return c, args, nil, nil
+	}
+	if c.isRunnable() {
+		options := c.Options
+		if a.isolated {
+			options = make([]*Option, len(c.Options))
+			for i, option := range c.Options {
+				options[i] = option.clone()
+			}
+		}
+		realArgs, err := newArgsParser(options, globals).ParseArgs(args...)
+		return c, realArgs, options, err
+	}
+	// global options may be placed before sub command names
+	args, err := newArgsParser(nil, globals).ParseLeadingOptions(args...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(args) == 0 {
+		return nil, nil, nil, UsageError("Command %s needs a subcommand among %v\n", c.Use, c.subCommandNames())
+	}
+	childFound := c.child(args[0])
+	if childFound == nil {
+		return nil, []string{args[0]}, nil, nil // no command found
+	}
+	return a.findRunnable(childFound, args[1:], globals)
+}
+
+func (e *execution) run(ctx context.Context) *XbeeError {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithValue(ctx, executionKey{}, e)
+	e.ctx = ctx
+	if IsDryRun(ctx) {
+		defer func() { fmt.Fprint(e.app.Stdout, DryRunSummary(ctx)) }()
+	}
+	if e.leaf.ValidateArgs != nil {
+		if err := e.leaf.ValidateArgs(e.realArgs); err != nil {
+			if err.Category() == "" {
+				return Wrap(CategoryUsage, err)
+			}
+			return err
+		}
+	}
+	if e.leaf.RunE != nil {
+		return e.leaf.RunE(ctx, e.realArgs)
+	}
+	if e.app.isolated {
+		legacyLock.Lock()
+		defer legacyLock.Unlock()
+		previous := current
+		current = e
+		defer func() { current = previous }()
+	}
+	return e.leaf.Run(e.realArgs)
+}
+
+// Options are the options parsed for a command : its own options, then global options.
+type Options struct {
+	leaf   map[string]*Option
+	global map[string]*Option
+}
+
+func optionMap(options []*Option) map[string]*Option {
+	result := make(map[string]*Option, len(options))
+	for _, option := range options {
+		result[option.Name] = option
+	}
+	return result
+}
+
+// Get returns the option named name, nil if the command has no such option.
+func (o *Options) Get(name string) *Option {
+	if o == nil {
+		return nil
+	}
+	if option, ok := o.leaf[name]; ok {
+		return option
+	}
+	return o.global[name]
+}
+
+func (o *Options) Has(name string) bool {
+	return o.Get(name) != nil
+}
+
+type executionKey struct{}
+
+func executionFrom(ctx context.Context) *execution {
+	if ctx != nil {
+		if e, ok := ctx.Value(executionKey{}).(*execution); ok {
+			return e
+		}
+	}
+	return current
+}
+
+// Context returns the context of the Run leaf being executed, cancelled on SIGINT or SIGTERM when run by Run.
+// Run leaves, which get no context, give it to what they start. Without leaf running, it is context.Background.
+// Functions taking a context use it when given nil.
+func Context() context.Context {
+	if current != nil && current.ctx != nil {
+		return current.ctx
+	}
+	return context.Background()
+}
+
+// OptionsFrom returns the options parsed for the command run with ctx, those of the default App otherwise.
+func OptionsFrom(ctx context.Context) *Options {
+	if e := executionFrom(ctx); e != nil {
+		return e.options
+	}
+	return nil
+}
+
+// XbeeFlagsFrom returns the --xbee flags given to the command run with ctx.
+func XbeeFlagsFrom(ctx context.Context) []string {
+	if e := executionFrom(ctx); e != nil {
+		return e.xbeeFlags
+	}
+	return XbeeFlags
+}
+
+// Stdout returns the stdout of the App running the command of ctx.
+func Stdout(ctx context.Context) io.Writer {
+	if e := executionFrom(ctx); e != nil {
+		return e.app.Stdout
+	}
+	return os.Stdout
+}
+
+func Stderr(ctx context.Context) io.Writer {
+	if e := executionFrom(ctx); e != nil {
+		return e.app.Stderr
+	}
+	return os.Stderr
+}
+
+func Stdin(ctx context.Context) io.Reader {
+	if e := executionFrom(ctx); e != nil {
+		return e.app.Stdin
+	}
+	return os.Stdin
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func appTree() *Command {
+	root := &Command{}
+	greet := NewCommand("greet").WithRunE(func(ctx context.Context, args []string) *XbeeError {
+		options := OptionsFrom(ctx)
+		fmt.Fprintf(Stdout(ctx), "%s %v %v", options.Get("name").StringValue(), options.Get("loud").BooleanValue(), args)
+		return nil
+	})
+	greet.Options = []*Option{NewOption("name", "n", "world"), NewBooleanOption("loud", "", false)}
+	_ = root.AddCommands(greet)
+	return root
+}
+
+func Test_AppExecuteInParallel(t *testing.T) {
+	root := appTree()
+	var wg sync.WaitGroup
+	outputs := make([]bytes.Buffer, 20)
+	for i := range outputs {
+		app := NewApp(root)
+		app.Stdout = &outputs[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			args := []string{"greet", fmt.Sprintf("-n%d", i), "arg"}
+			if i%2 == 0 {
+				args = append(args, "--loud")
+			}
+			if err := app.Execute(context.Background(), args); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := range outputs {
+		if expected := fmt.Sprintf("%d %v [arg]", i, i%2 == 0); outputs[i].String() != expected {
+			t.Errorf("expected %q, actual is %q", expected, outputs[i].String())
+		}
+	}
+}
+
+func Test_AppExecuteTwice(t *testing.T) {
+	var out bytes.Buffer
+	app := NewApp(appTree())
+	app.Stdout = &out
+	if err := app.Execute(context.Background(), []string{"greet", "--name", "bob", "--loud"}); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := app.Execute(context.Background(), []string{"--xbeeDebug", "greet"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "world false []"; out.String() != expected {
+		t.Errorf("expected %q, actual is %q", expected, out.String())
+	}
+	if err := app.Execute(context.Background(), []string{"unknown"}); err == nil {
+		t.Errorf("expected unknown command error")
+	}
+}
+
+func Test_ForceAndConfirm(t *testing.T) {
+	var confirmed, forced, legacyForced bool
+	rm := NewCommand("rm").WithRunE(func(ctx context.Context, _ []string) *XbeeError {
+		forced, confirmed = ForceContext(ctx), ConfirmContext(ctx, "delete")
+		return nil
+	})
+	rm.Options = []*Option{NewForceOption()}
+	legacy := NewCommand("legacy").WithRun(func([]string) *XbeeError {
+		legacyForced = Force()
+		return nil
+	})
+	legacy.Options = []*Option{NewForceOption()}
+	root := &Command{}
+	_ = root.AddCommands(rm, legacy)
+	var out bytes.Buffer
+	app := NewApp(root)
+	app.Stdout, app.Stdin = &out, strings.NewReader("maybe\nn\n")
+	if err := app.Execute(context.Background(), []string{"rm"}); err != nil {
+		t.Fatal(err)
+	}
+	if forced || confirmed {
+		t.Errorf("expected no force and no confirmation, actual are %v and %v", forced, confirmed)
+	}
+	if expected := "Confirm delete ? [y,n]: Sorry, i do not understand\nConfirm delete ? [y,n]: "; out.String() != expected {
+		t.Errorf("expected %q, actual is %q", expected, out.String())
+	}
+	if err := app.Execute(context.Background(), []string{"rm", "--force"}); err != nil {
+		t.Fatal(err)
+	}
+	if !forced || !confirmed {
+		t.Errorf("expected confirmation forced, actual are %v and %v", forced, confirmed)
+	}
+	if err := app.Execute(context.Background(), []string{"legacy", "-f"}); err != nil {
+		t.Fatal(err)
+	}
+	if !legacyForced {
+		t.Errorf("expected Force to see --force of the Run leaf")
+	}
+}
+
+func Test_ContextOfRunLeaf(t *testing.T) {
+	var err error
+	legacy := NewCommand("legacy").WithRun(func([]string) *XbeeError {
+		err = Context().Err()
+		return nil
+	})
+	root := &Command{}
+	_ = root.AddCommands(legacy)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if xe := NewApp(root).Execute(ctx, []string{"legacy"}); xe != nil {
+		t.Fatal(xe)
+	}
+	if err != context.Canceled {
+		t.Errorf("expected the Run leaf to see its context cancelled, actual error is %v", err)
+	}
+}
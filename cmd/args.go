@@ -1,55 +1,217 @@
 package cmd
 
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
 type ArgsParser struct {
 	options map[string]*Option
+	globals map[string]*Option
 }
 
 func NewArgsParser(options []*Option) *ArgsParser {
-	optionMap := make(map[string]*Option)
-	for _, option := range options {
-		optionMap[option.Name] = option
-	}
+	return newArgsParser(options, globalOptions)
+}
+
+func newArgsParser(options []*Option, globals map[string]*Option) *ArgsParser {
 	return &ArgsParser{
-		options: optionMap,
-	}
-}
-
-func (ap *ArgsParser) ParseArgs(args ...string) (realArgs []string) {
-	var skipIteration bool
-	for i, arg := range args {
-		if skipIteration {
-			skipIteration = false
-		} else {
-			option := ap.optionFor(arg)
-			if option != nil {
-				if option.IsBool() {
-					option.Enable(true)
-				} else if i < len(args)-1 {
-					option.AddValue(args[i+1])
-					skipIteration = true
-				} else { //degenerated case.
-					realArgs = append(realArgs, args[i:]...)
-					break
-				}
-			} else {
-				realArgs = append(realArgs, args[i:]...)
-				break
+		options: optionMap(options),
+		globals: globals,
+	}
+}
+
+// ParseArgs sets options found anywhere in args, GNU style, and returns positional args :
+//
+//	--name value, --name=value, -n value, -nvalue
+//	-abc for boolean options a, b and c, --no-name to disable boolean option name
+//	-- ends options, all following args are positional
+//
+// An unknown option is an error, suggesting the closest option names.
+func (ap *ArgsParser) ParseArgs(args ...string) ([]string, *XbeeError) {
+	var realArgs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(realArgs, args[i+1:]...), nil
+		}
+		if !isOption(arg) {
+			realArgs = append(realArgs, arg)
+			continue
+		}
+		consumed, err := ap.parseOption(arg, args[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		i += consumed
+	}
+	return realArgs, nil
+}
+
+// isShortOptions returns true for -x forms, a single dash or a negative number being positional.
+func isShortOptions(arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' {
+		return false
+	}
+	_, err := strconv.ParseFloat(arg, 64)
+	return err != nil
+}
+
+// parseLong parses --name, --name=value or --no-name, and returns how many of next args were consumed as value.
+func (ap *ArgsParser) parseLong(arg string, next []string) (int, *XbeeError) {
+	name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+	option := ap.optionNamed(name)
+	if option == nil {
+		if negated, ok := strings.CutPrefix(name, "no-"); ok && !hasValue {
+			if option = ap.optionNamed(negated); option != nil && option.IsBool() {
+				option.Enable(false)
+				return 0, nil
 			}
 		}
+		return 0, ap.unknown("--"+name, name)
+	}
+	if option.IsBool() {
+		if !hasValue {
+			option.Enable(true)
+			return 0, nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return 0, UsageError("boolean option --%s expects true or false, actual is %s", name, value)
+		}
+		option.Enable(b)
+		return 0, nil
+	}
+	if hasValue {
+		return 0, option.parseValue(value)
+	}
+	if len(next) == 0 {
+		return 0, UsageError("option --%s needs a value", name)
+	}
+	return 1, option.parseValue(next[0])
+}
+
+// parseShort parses -x, -xvalue or bundled booleans -xyz, and returns how many of next args were consumed as value.
+func (ap *ArgsParser) parseShort(arg string, next []string) (int, *XbeeError) {
+	letters := arg[1:]
+	for i, letter := range letters {
+		shortHand := string(letter)
+		option := ap.optionWithShortHand(shortHand)
+		if option == nil {
+			return 0, ap.unknown("-"+shortHand, "")
+		}
+		if option.IsBool() {
+			option.Enable(true)
+			continue
+		}
+		if rest := letters[i+len(shortHand):]; rest != "" {
+			return 0, option.parseValue(strings.TrimPrefix(rest, "="))
+		}
+		if len(next) == 0 {
+			return 0, UsageError("option -%s needs a value", shortHand)
+		}
+		return 1, option.parseValue(next[0])
 	}
-	return
+	return 0, nil
 }
 
-func (ap *ArgsParser) optionFor(arg string) *Option {
+// ParseLeadingOptions sets options at start of args, and returns the remaining args.
+func (ap *ArgsParser) ParseLeadingOptions(args ...string) ([]string, *XbeeError) {
+	for len(args) > 0 && isOption(args[0]) {
+		consumed, err := ap.parseOption(args[0], args[1:])
+		if err != nil {
+			return nil, err
+		}
+		args = args[1+consumed:]
+	}
+	return args, nil
+}
+
+func isOption(arg string) bool {
+	return arg != "--" && (strings.HasPrefix(arg, "--") || isShortOptions(arg))
+}
+
+// parseOption parses arg, which is an option, and returns how many of next args were consumed as value.
+func (ap *ArgsParser) parseOption(arg string, next []string) (int, *XbeeError) {
+	if strings.HasPrefix(arg, "--") {
+		return ap.parseLong(arg, next)
+	}
+	return ap.parseShort(arg, next)
+}
+
+func (ap *ArgsParser) optionNamed(name string) *Option {
+	if option, ok := ap.options[name]; ok {
+		return option
+	}
+	return ap.globals[name]
+}
+
+func (ap *ArgsParser) optionWithShortHand(shortHand string) *Option {
 	for _, option := range ap.options {
-		if option.IsArgForMe(arg) {
+		if option.ShortHand == shortHand {
 			return option
 		}
 	}
-	for _, option := range globalOptions {
-		if option.IsArgForMe(arg) {
+	for _, option := range ap.globals {
+		if option.ShortHand == shortHand {
 			return option
 		}
 	}
 	return nil
 }
+
+func (ap *ArgsParser) unknown(arg string, name string) *XbeeError {
+	if suggestions := ap.suggestions(name); len(suggestions) > 0 {
+		return UsageError("unknown option %s, did you mean --%s ?", arg, strings.Join(suggestions, " or --"))
+	}
+	return UsageError("unknown option %s", arg)
+}
+
+// suggestions returns option names close to name, closest first.
+func (ap *ArgsParser) suggestions(name string) []string {
+	if name == "" {
+		return nil
+	}
+	maxDistance := max(2, len(name)/3)
+	distances := map[string]int{}
+	for _, options := range []map[string]*Option{ap.options, ap.globals} {
+		for candidate := range options {
+			if d := editDistance(name, candidate); d <= maxDistance || strings.HasPrefix(candidate, name) {
+				distances[candidate] = d
+			}
+		}
+	}
+	var result []string
+	for candidate := range distances {
+		result = append(result, candidate)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if distances[result[i]] != distances[result[j]] {
+			return distances[result[i]] < distances[result[j]]
+		}
+		return result[i] < result[j]
+	})
+	return result
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
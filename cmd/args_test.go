@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testOptions() (*Option, *Option, *Option, []*Option) {
+	force := NewBooleanOption("force", "f", false)
+	update := NewBooleanOption("update", "u", true)
+	env := NewOption("env", "e", "")
+	return force, update, env, []*Option{force, update, env}
+}
+
+func Test_ParseArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		realArgs []string
+		force    bool
+		update   bool
+		env      []string
+	}{
+		{[]string{"a", "--env", "x", "b"}, []string{"a", "b"}, false, true, []string{"x"}},
+		{[]string{"--env=x=y", "-e", "z"}, nil, false, true, []string{"x=y", "z"}},
+		{[]string{"-fe", "x", "a"}, []string{"a"}, true, true, []string{"x"}},
+		{[]string{"-fex", "--no-update"}, nil, true, false, []string{"x"}},
+		{[]string{"--force=false", "a", "--", "-f", "--env"}, []string{"a", "-f", "--env"}, false, true, nil},
+		{[]string{"-", "-1"}, []string{"-", "-1"}, false, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			force, update, env, options := testOptions()
+			realArgs, err := NewArgsParser(options).ParseArgs(tt.args...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(realArgs, tt.realArgs) {
+				t.Errorf("expected args %v, actual is %v", tt.realArgs, realArgs)
+			}
+			if force.BooleanValue() != tt.force || update.BooleanValue() != tt.update {
+				t.Errorf("expected force=%v update=%v, actual is force=%v update=%v", tt.force, tt.update, force.BooleanValue(), update.BooleanValue())
+			}
+			if !slices.Equal(env.StringValues(), tt.env) {
+				t.Errorf("expected env %v, actual is %v", tt.env, env.StringValues())
+			}
+		})
+	}
+}
+
+func Test_ParseArgsErrors(t *testing.T) {
+	tests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--forse"}, "unknown option --forse, did you mean --force ?"},
+		{[]string{"-z"}, "unknown option -z"},
+		{[]string{"a", "--env"}, "option --env needs a value"},
+		{[]string{"--force=maybe"}, "boolean option --force expects true or false"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			_, _, _, options := testOptions()
+			_, err := NewArgsParser(options).ParseArgs(tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected error %q, actual is %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func Test_RepeatedUntypedOptionKeepsFirstValue(t *testing.T) {
+	name := NewOption("name", "n", "")
+	if _, err := NewArgsParser([]*Option{name}).ParseArgs("--name", "first", "--name", "second"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name.StringValue() != "first" {
+		t.Errorf("expected first value, actual is %s", name.StringValue())
+	}
+}
+
+func Test_ParseTypedOptions(t *testing.T) {
+	count := NewIntOption("count", "c", 1)
+	timeout := NewDurationOption("timeout", "", time.Minute)
+	level := NewEnumOption("level", "", "info", "info", "debug")
+	labels := NewMapOption("label", "")
+	parser := NewArgsParser([]*Option{count, timeout, level, labels})
+	if _, err := parser.ParseArgs("-c3", "--timeout", "1s", "--timeout", "90s", "--level=debug", "--label", "a=1,b=2", "--label=a=3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count.IntValue() != 3 || timeout.DurationValue() != 90*time.Second || level.StringValue() != "debug" {
+		t.Errorf("unexpected values: %d, %s, %s", count.IntValue(), timeout.DurationValue(), level.StringValue())
+	}
+	if labels := labels.MapValue(); len(labels) != 2 || labels["a"] != "3" || labels["b"] != "2" {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+
+	for args, message := range map[string]string{
+		"--count=x":     "option --count expects an integer, actual is x",
+		"--timeout=10":  "option --timeout expects a duration",
+		"--level=trace": "option --level expects one of info, debug, actual is trace",
+		"--label=a":     "option --label expects key=value, actual is a",
+	} {
+		if _, err := parser.ParseArgs(args); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expected error %q, actual is %v", message, err)
+		}
+	}
+	if usage := displayOptions([]*Option{level}); !strings.Contains(usage, "--level <enum>") || !strings.Contains(usage, "(one of info, debug)") {
+		t.Errorf("enum values not in usage: %s", usage)
+	}
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"errors"
+	"slices"
+)
+
+// Category classifies errors, so that callers and scripts can react differently to a bad config file and to
+// a cloud API timing out. Each category has a stable process exit code, see ExitCode.
+type Category string
+
+const (
+	CategoryUsage         Category = "usage"          // bad command line
+	CategoryConfig        Category = "config"         // bad env.yaml, config file or environment variable
+	CategoryNotFound      Category = "not-found"      // missing host, volume, file...
+	CategoryConflict      Category = "conflict"       // resource already exists or is in a wrong state
+	CategoryTimeout       Category = "timeout"        // operation took too long
+	CategoryRemoteFailure Category = "remote-failure" // remote host or cloud API failed
+	CategoryInternal      Category = "internal"       // bug
+)
+
+// exitCodes are stable : never change a value, only add new ones. Uncategorized errors exit with 1, and
+// commands interrupted by a signal with 128 + signal number.
+var exitCodes = map[Category]int{
+	CategoryUsage:         2,
+	CategoryConfig:        3,
+	CategoryNotFound:      4,
+	CategoryConflict:      5,
+	CategoryTimeout:       6,
+	CategoryRemoteFailure: 7,
+	CategoryInternal:      8,
+}
+
+// ExitCode returns the process exit code of errors of category c, 1 for unknown categories.
+func (c Category) ExitCode() int {
+	if code, ok := exitCodes[c]; ok {
+		return code
+	}
+	return 1
+}
+
+func categorized(c Category, format string, args ...interface{}) *XbeeError {
+	err := Error(format, args...)
+	err.SkipFirst(7)
+	err.category = c
+	return err
+}
+
+func UsageError(format string, args ...interface{}) *XbeeError {
+	return categorized(CategoryUsage, format, args...)
+}
+
+func ConfigError(format string, args ...interface{}) *XbeeError {
+	return categorized(CategoryConfig, format, args...)
+}
+
+func NotFoundError(format string, args ...interface{}) *XbeeError {
+	return categorized(CategoryNotFound, format, args...)
+}
+
+func ConflictError(format string, args ...interface{}) *XbeeError {
+	return categorized(CategoryConflict, format, args...)
+}
+
+func TimeoutError(format string, args ...interface{}) *XbeeError {
+	return categorized(CategoryTimeout, format, args...)
+}
+
+func RemoteError(format string, args ...interface{}) *XbeeError {
+	return categorized(CategoryRemoteFailure, format, args...)
+}
+
+func InternalError(format string, args ...interface{}) *XbeeError {
+	return categorized(CategoryInternal, format, args...)
+}
+
+// Wrap returns err classified in category c, nil if err is nil. An XbeeError is copied, not modified ; another
+// error, even wrapping an XbeeError, keeps its message and is wrapped.
+func Wrap(c Category, err error) *XbeeError {
+	if xe, ok := err.(*XbeeError); ok {
+		if xe == nil {
+			return nil
+		}
+		wrapped := *xe
+		wrapped.category = c
+		wrapped.fields = slices.Clone(xe.fields)
+		return &wrapped
+	}
+	if err == nil {
+		return nil
+	}
+	return categorized(c, "%w", err)
+}
+
+// Category returns the category of xe, or else the first category found among its causes, then the errors
+// following it. It is empty if no error of the tree is categorized.
+func (xe *XbeeError) Category() Category {
+	if xe == nil {
+		return ""
+	}
+	if xe.category != "" {
+		return xe.category
+	}
+	for _, errs := range [][]*XbeeError{xe.origins, xe.follows} {
+		for _, e := range errs {
+			if c := e.Category(); c != "" {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+// ExitCode returns the process exit code for xe : its code if set, the one of its category otherwise.
+func (xe *XbeeError) ExitCode() int {
+	if xe.code != 0 {
+		return xe.code
+	}
+	return xe.Category().ExitCode()
+}
+
+// Is returns true if err is an XbeeError of category c.
+func Is(err error, c Category) bool {
+	var xe *XbeeError
+	return errors.As(err, &xe) && xe.Category() == c
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_Categories(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      *XbeeError
+		category Category
+		exitCode int
+	}{
+		{"uncategorized", Error("boom"), "", 1},
+		{"usage", UsageError("bad flag %s", "-x"), CategoryUsage, 2},
+		{"wrapped", Wrap(CategoryConfig, errors.New("bad env.yaml")), CategoryConfig, 3},
+		{"cause", CauseBy(Error("first"), TimeoutError("slow")), CategoryTimeout, 6},
+		{"remote", RemoteError("api down"), CategoryRemoteFailure, 7},
+		{"parse", func() *XbeeError { _, err := NewArgsParser(nil).ParseArgs("--unknown"); return err }(), CategoryUsage, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.err.Category(); actual != tt.category {
+				t.Errorf("expected category %q, actual is %q", tt.category, actual)
+			}
+			if actual := tt.err.ExitCode(); actual != tt.exitCode {
+				t.Errorf("expected exit code %d, actual is %d", tt.exitCode, actual)
+			}
+		})
+	}
+}
+
+func Test_Wrap(t *testing.T) {
+	original := NotFoundError("no volume %s", "data")
+	wrapped := Wrap(CategoryConflict, original)
+	if !Is(wrapped, CategoryConflict) || !Is(original, CategoryNotFound) {
+		t.Errorf("Wrap must categorize a copy of the error")
+	}
+	original.WithFile("a.yaml").WithField("volume", "data").WithCommand("mount")
+	withHost := Wrap(CategoryConflict, original).WithHost("h1")
+	Wrap(CategoryConflict, original).WithHost("h2")
+	if len(original.fields) != 3 || withHost.fields[3].Value != "h1" {
+		t.Errorf("fields added to a wrapped error must not be shared, actual are %v and %v", original.fields, withHost.fields)
+	}
+	outer := Wrap(CategoryConfig, fmt.Errorf("cannot load config : %w", original))
+	if !strings.HasPrefix(outer.message, "cannot load config : ") || !Is(outer, CategoryConfig) || !errors.Is(outer, original) {
+		t.Errorf("Wrap must keep the outer message, actual is %q in category %s", outer.message, outer.Category())
+	}
+	if Wrap(CategoryInternal, nil) != nil {
+		t.Errorf("Wrap of nil must be nil")
+	}
+	var nilErr *XbeeError
+	if Is(nilErr, CategoryUsage) || Is(errors.New("plain"), CategoryUsage) {
+		t.Errorf("only categorized XbeeErrors have a category")
+	}
+}
@@ -2,20 +2,31 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"sync"
 	"text/template"
 )
 
 type Command struct {
-	Use          string
-	Short        string
-	Long         string
-	Aliases      []string
-	Hidden       bool
-	Run          func([]string) *XbeeError
+	Use     string
+	Short   string
+	Long    string
+	Example string // shown verbatim in usage and reference docs
+	Aliases []string
+	Hidden  bool
+	Run     func([]string) *XbeeError
+	// RunE runs the command with a context carrying its parsed options, see OptionsFrom. It wins over Run.
+	RunE         func(ctx context.Context, args []string) *XbeeError
 	commands     map[string]*Command
 	Options      []*Option
 	ValidateArgs func([]string) *XbeeError
-	parent       *Command // used to display usage
+	// Complete returns candidates for the positional arg toComplete, args being the positional args already typed.
+	Complete func(args []string, toComplete string) []string
+	parent   *Command // used to display usage
+	// passThrough commands receive their args unparsed, like plugins
+	passThrough bool
+	// describe fills Short and Long of a lazy command, like a plugin, before they are displayed
+	describe func()
 }
 
 func NewCommand(name string, aliases ...string) *Command {
@@ -30,6 +41,31 @@ func (c *Command) WithRun(f func([]string) *XbeeError) *Command {
 	return c
 }
 
+func (c *Command) WithRunE(f func(ctx context.Context, args []string) *XbeeError) *Command {
+	c.RunE = f
+	return c
+}
+
+// isRunnable returns true for leaf commands.
+func (c *Command) isRunnable() bool {
+	return c.Run != nil || c.RunE != nil
+}
+
+// describe fills descriptions of lazy commands among commands, in parallel.
+func describe(commands []*Command) {
+	var wg sync.WaitGroup
+	for _, c := range commands {
+		if c.describe != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.describe()
+			}()
+		}
+	}
+	wg.Wait()
+}
+
 func (c *Command) notHidden() map[string]*Command {
 	result := map[string]*Command{}
 	for k, v := range c.commands {
@@ -52,7 +88,7 @@ func (c *Command) AddCommand(child *Command) (bool, *XbeeError) {
 		child.parent = c
 		return true, nil
 	} else {
-		if child.Run != nil {
+		if child.isRunnable() {
 			return false, Error("cannot add leaf command %s to %s, one already added", child.Use, c.Use)
 		}
 		existingChild.AddCommands(child.commandsList()...)
@@ -75,14 +111,21 @@ func (c *Command) AvailableSubCommandsToDisplay() (string, *XbeeError) {
 	if err != nil { //should not occur
 		return "", Error("unexpected internal error when trying to parse template that list sub commands : %v", err)
 	}
+	children := c.notHidden()
+	var list []*Command
+	for _, child := range children {
+		list = append(list, child)
+	}
+	describe(list)
 	sb := new(bytes.Buffer)
-	err = t.Execute(sb, c.notHidden())
+	err = t.Execute(sb, children)
 	if err != nil {
 		return "", Error("unexpected internal error when trying to render the list of sub commands : %v", err)
 	}
 	return sb.String(), nil
 }
 func (c *Command) Usage() (string, *XbeeError) {
+	describe([]*Command{c})
 	t := template.New("usage")
 	t, err := t.Parse(usageTpl)
 	if err != nil { //should not occur
@@ -99,11 +142,11 @@ func (c *Command) OptionsToDisplay() string {
 	return displayOptions(c.Options)
 }
 func (c *Command) GlobalOptionsToDisplay() string {
-	var options []*Option
-	for _, option := range globalOptions {
-		options = append(options, option)
-	}
-	return displayOptions(options)
+	return displayOptions(sortedGlobalOptions())
+}
+
+func (c *Command) ProgramName() string {
+	return programName
 }
 
 func (c *Command) Path() (result string) {
@@ -1,9 +1,18 @@
 package cmd
 
+import "context"
+
 func UpdateOption() *Option { return NewBooleanOption("update", "u", false) }
+
+// Update returns true if the command run by the default App was given --update.
 func Update() bool {
-	if HasOption("update") {
-		return OptionFrom("update").BooleanValue()
+	return UpdateContext(nil)
+}
+
+// UpdateContext returns true if the command run with ctx was given --update.
+func UpdateContext(ctx context.Context) bool {
+	if options := OptionsFrom(ctx); options.Has("update") {
+		return options.Get("update").BooleanValue()
 	}
 	return false
 }
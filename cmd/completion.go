@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// completeCommandName is the hidden command called by completion scripts : prog __complete [WORD...] TO_COMPLETE
+// prints candidates for TO_COMPLETE, one per line, WORD being the words already typed after the program name.
+const completeCommandName = "__complete"
+
+// programName is the name of the program in usage, completion scripts and reference docs.
+var programName = "xbee"
+
+// SetProgramName sets the name of the program, xbee by default.
+func SetProgramName(name string) {
+	programName = name
+}
+
+func ProgramName() string {
+	return programName
+}
+
+var completionScripts = map[string]string{
+	"bash":       bashCompletionTpl,
+	"zsh":        zshCompletionTpl,
+	"fish":       fishCompletionTpl,
+	"powershell": powershellCompletionTpl,
+}
+
+// addBuiltinCommands adds config, and hidden completion and __complete commands to root, unless already defined.
+func addBuiltinCommands(root *Command) *XbeeError {
+	var commands []*Command
+	if _, ok := root.commands["config"]; !ok {
+		commands = append(commands, NewConfigCommand())
+	}
+	if _, ok := root.commands["completion"]; !ok {
+		commands = append(commands, completionCommand())
+	}
+	if _, ok := root.commands[completeCommandName]; !ok {
+		commands = append(commands, &Command{
+			Use:    completeCommandName,
+			Hidden: true,
+			RunE: func(ctx context.Context, args []string) *XbeeError {
+				for _, candidate := range Complete(root, args) {
+					fmt.Fprintln(Stdout(ctx), candidate)
+				}
+				return nil
+			},
+		})
+	}
+	return root.AddCommands(commands...)
+}
+
+func completionCommand() *Command {
+	return &Command{
+		Use:   "completion",
+		Short: "Generate completion script for bash, zsh, fish or powershell",
+		Long:  "Generate completion script for bash, zsh, fish or powershell.",
+		Example: fmt.Sprintf("  source <(%s completion bash)\n  %s completion fish > ~/.config/fish/completions/%s.fish",
+			programName, programName, programName),
+		Hidden: true,
+		ValidateArgs: func(args []string) *XbeeError {
+			if len(args) != 1 || completionScripts[args[0]] == "" {
+				return UsageError("completion expects one shell among bash, zsh, fish or powershell, actual is %v", args)
+			}
+			return nil
+		},
+		RunE: func(ctx context.Context, args []string) *XbeeError {
+			t, err := template.New(args[0]).Parse(completionScripts[args[0]])
+			if err != nil { //should not occur
+				return Error("unexpected internal error when trying to parse %s completion script : %v", args[0], err)
+			}
+			if err := t.Execute(Stdout(ctx), programName); err != nil {
+				return Error("cannot render %s completion script : %v", args[0], err)
+			}
+			return nil
+		},
+	}
+}
+
+// Complete returns candidates for the last of words, words being typed after the program name.
+// Candidates are sub commands, options, values of enum options or values given by Option.Complete
+// and Command.Complete functions.
+func Complete(root *Command, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	toComplete := words[len(words)-1]
+	current := root
+	var positional []string
+	var pending *Option // option waiting for its value
+	for _, word := range words[:len(words)-1] {
+		if pending != nil {
+			pending = nil
+			continue
+		}
+		if isOption(word) {
+			pending = optionWaitingValue(current, word)
+			continue
+		}
+		if !current.isRunnable() {
+			if child := current.child(word); child != nil {
+				current = child
+				continue
+			}
+		}
+		positional = append(positional, word)
+	}
+	var candidates []string
+	switch {
+	case pending != nil:
+		candidates = pending.completeValue(toComplete)
+	case strings.HasPrefix(toComplete, "--") && strings.Contains(toComplete, "="):
+		name, value, _ := strings.Cut(strings.TrimPrefix(toComplete, "--"), "=")
+		if option := NewArgsParser(current.Options).optionNamed(name); option != nil {
+			for _, candidate := range option.completeValue(value) {
+				candidates = append(candidates, "--"+name+"="+candidate)
+			}
+		}
+	case strings.HasPrefix(toComplete, "-"):
+		for _, option := range append(current.Options, sortedGlobalOptions()...) {
+			candidates = append(candidates, "--"+option.Name)
+		}
+	case !current.isRunnable():
+		candidates = current.subCommandNames()
+	case current.Complete != nil:
+		return current.Complete(positional, toComplete)
+	}
+	return withPrefix(candidates, toComplete)
+}
+
+// optionWaitingValue returns the option given by word if its value is the next word.
+func optionWaitingValue(c *Command, word string) *Option {
+	if strings.Contains(word, "=") {
+		return nil
+	}
+	parser := NewArgsParser(c.Options)
+	var option *Option
+	if strings.HasPrefix(word, "--") {
+		option = parser.optionNamed(strings.TrimPrefix(word, "--"))
+	} else if len(word) == 2 {
+		option = parser.optionWithShortHand(word[1:])
+	}
+	if option == nil || option.IsBool() {
+		return nil
+	}
+	return option
+}
+
+func (op *Option) completeValue(toComplete string) []string {
+	if op.Complete != nil {
+		return op.Complete(toComplete)
+	}
+	if op.isBool {
+		return withPrefix([]string{"true", "false"}, toComplete)
+	}
+	return withPrefix(op.allowed, toComplete)
+}
+
+func (c *Command) child(name string) *Command {
+	for _, childC := range c.commands {
+		if childC.Use == name {
+			return childC
+		}
+		for _, alias := range childC.Aliases {
+			if alias == name {
+				return childC
+			}
+		}
+	}
+	return nil
+}
+
+func sortedGlobalOptions() (result []*Option) {
+	for _, option := range globalOptions {
+		result = append(result, option)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return
+}
+
+func withPrefix(candidates []string, prefix string) (result []string) {
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			result = append(result, candidate)
+		}
+	}
+	sort.Strings(result)
+	return
+}
+
+// bashCompletionTpl joins back words split by bash at = (see COMP_WORDBREAKS), when nothing separates them in
+// the line, so that --name=value reaches __complete as one word. Bash replaces only the text after the last =.
+const bashCompletionTpl = `# bash completion for {{ . }}
+_{{ . }}_complete() {
+    local IFS=$'\n'
+    local rest="$COMP_LINE" words=() word i
+    for ((i = 0; i <= COMP_CWORD; i++)); do
+        word="${COMP_WORDS[i]}"
+        if [[ $i -gt 1 && ( $word == "=" || ${words[-1]} == *= ) && ${rest:0:1} != [[:space:]] ]]; then
+            words[-1]+="$word"
+        else
+            words+=("$word")
+        fi
+        rest="${rest#"${rest%%[![:space:]]*}"}"
+        rest="${rest#"$word"}"
+    done
+    local cur="${words[-1]}"
+    COMPREPLY=($({{ . }} __complete "${words[@]:1:${#words[@]}-2}" "$cur" 2>/dev/null))
+    if [[ $cur == *=* && $COMP_WORDBREAKS == *=* ]]; then
+        COMPREPLY=("${COMPREPLY[@]#"${cur%=*}="}")
+    fi
+}
+complete -o default -F _{{ . }}_complete {{ . }}
+`
+
+const zshCompletionTpl = `#compdef {{ . }}
+_{{ . }}() {
+    local -a candidates
+    candidates=(${(f)"$({{ . }} __complete "${(@)words[2,CURRENT-1]}" "${words[CURRENT]}" 2>/dev/null)"})
+    compadd -a candidates
+}
+compdef _{{ . }} {{ . }}
+`
+
+const fishCompletionTpl = `# fish completion for {{ . }}
+function __{{ . }}_complete
+    set -l tokens (commandline -opc)
+    set -e tokens[1]
+    {{ . }} __complete $tokens (commandline -ct) 2>/dev/null
+end
+complete -c {{ . }} -f -a '(__{{ . }}_complete)'
+`
+
+const powershellCompletionTpl = `# powershell completion for {{ . }}
+Register-ArgumentCompleter -Native -CommandName '{{ . }}' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -ne '' -and $words.Count -gt 0) {
+        $words = @($words | Select-Object -SkipLast 1)
+    }
+    & '{{ . }}' __complete @words "$wordToComplete" 2>$null | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func completionTree() *Command {
+	root := &Command{}
+	env := NewEnumOption("env", "e", "dev", "dev", "prod")
+	up := NewCommand("up").WithRun(func([]string) *XbeeError { return nil })
+	up.Options = []*Option{NewBooleanOption("force", "f", false), env}
+	up.Complete = func(args []string, toComplete string) []string {
+		return []string{"host" + toComplete + strings.Join(args, "")}
+	}
+	volume := NewCommand("volume", "vol")
+	_ = volume.AddCommands(NewCommand("delete").WithRun(func([]string) *XbeeError { return nil }))
+	_ = root.AddCommands(up, volume, &Command{Use: "secret", Hidden: true, Run: up.Run})
+	return root
+}
+
+func Test_Complete(t *testing.T) {
+	root := completionTree()
+	tests := []struct {
+		words    []string
+		expected []string
+	}{
+		{[]string{""}, []string{"up", "volume"}},
+		{[]string{"vo"}, []string{"volume"}},
+		{[]string{"vol", ""}, []string{"delete"}},
+		{[]string{"up", "--fo"}, []string{"--force"}},
+		{[]string{"up", "-e", "p"}, []string{"prod"}},
+		{[]string{"up", "--env="}, []string{"--env=dev", "--env=prod"}},
+		{[]string{"up", "-f", "a", "--env", "dev", "1"}, []string{"host1a"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.words, " "), func(t *testing.T) {
+			if actual := Complete(root, tt.words); !slices.Equal(actual, tt.expected) {
+				t.Errorf("expected %v, actual is %v", tt.expected, actual)
+			}
+		})
+	}
+	if actual := Complete(root, []string{"up", "--"}); !slices.Contains(actual, "--log") && !slices.Contains(actual, "--help") {
+		t.Errorf("global options not completed: %v", actual)
+	}
+}
+
+func Test_BashCompletionJoinsEqualSign(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+	bin := t.TempDir()
+	// the fake program records the words given to __complete
+	fake := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + filepath.Join(bin, "args") + "\nprintf '%s\\n' --env=dev --env=prod\n"
+	if err := os.WriteFile(filepath.Join(bin, "xbeetest"), []byte(fake), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var script strings.Builder
+	if err := template.Must(template.New("bash").Parse(bashCompletionTpl)).Execute(&script, "xbeetest"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		line     string
+		words    string
+		args     string
+		expected string
+	}{
+		{"xbeetest up --env=pr", "(xbeetest up --env = pr)", "__complete up --env=pr", "dev prod"},
+		{"xbeetest up --env=", "(xbeetest up --env =)", "__complete up --env=", "dev prod"},
+		{"xbeetest up --env pr", "(xbeetest up --env pr)", "__complete up --env pr", "--env=dev --env=prod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			run := script.String() + "COMP_LINE='" + tt.line + "'\nCOMP_WORDS=" + tt.words + "\nCOMP_CWORD=$((${#COMP_WORDS[@]} - 1))\n" +
+				"_xbeetest_complete\necho \"${COMPREPLY[*]}\"\n"
+			c := exec.Command(bash, "-c", run)
+			c.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+			out, err := c.Output()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := strings.TrimSpace(string(out)); actual != tt.expected {
+				t.Errorf("expected candidates %q, actual are %q", tt.expected, actual)
+			}
+			args, _ := os.ReadFile(filepath.Join(bin, "args"))
+			if actual := strings.Join(strings.Fields(string(args)), " "); actual != tt.args {
+				t.Errorf("expected args %q, actual are %q", tt.args, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	// yaml2 depends on cmd : config files are decoded with yaml.v3 directly, as newfs does
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of option values, from the highest precedence to the lowest. Config sources are followed by the file path.
+const (
+	SourceFlag          = "flag"
+	SourceEnv           = "env"
+	SourceProjectConfig = "project config"
+	SourceUserConfig    = "user config"
+	SourceDefault       = "default"
+)
+
+// UserConfigFile returns ~/.xbee/config.yaml.
+func UserConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".xbee", "config.yaml")
+}
+
+// ProjectConfigFile returns .xbee/config.yaml in the current directory.
+func ProjectConfigFile() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(wd, ".xbee", "config.yaml")
+}
+
+// bindOptions sets options not given as flags from their env var, then from the project config file, then from
+// the user config file. Keys of config files are option names. Config files are shared by xbee, providers and
+// plugins : a key unknown to this program, among known options, is only reported as a warning on warnings.
+func bindOptions(options []*Option, known map[string]*Option, warnings io.Writer, userFile string, projectFile string) *XbeeError {
+	userConfig, err := loadConfig(userFile, known, warnings)
+	if err != nil {
+		return err
+	}
+	projectConfig, err := loadConfig(projectFile, known, warnings)
+	if err != nil {
+		return err
+	}
+	for _, op := range options {
+		if op.isSet {
+			continue
+		}
+		if value, ok := os.LookupEnv(op.envVar); op.envVar != "" && ok {
+			err = op.setFrom(SourceEnv+" "+op.envVar, []string{value})
+		} else if values, ok := projectConfig[op.Name]; ok {
+			err = op.setFrom(SourceProjectConfig+" "+projectFile, values)
+		} else if values, ok := userConfig[op.Name]; ok {
+			err = op.setFrom(SourceUserConfig+" "+userFile, values)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadConfig returns values of known options in a config file, by option name. A missing file has no value.
+func loadConfig(path string, known map[string]*Option, warnings io.Writer) (map[string][]string, *XbeeError) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ConfigError("cannot read config file %s : %v", path, err)
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, ConfigError("cannot parse config file %s : %v", path, err)
+	}
+	result := map[string][]string{}
+	for name, value := range raw {
+		if _, ok := known[name]; !ok {
+			if suggestions := newArgsParser(nil, known).suggestions(name); len(suggestions) > 0 {
+				fmt.Fprintf(warnings, "warning: unknown key %s in config file %s, did you mean %s ?\n", name, path, strings.Join(suggestions, " or "))
+			} else {
+				fmt.Fprintf(warnings, "warning: unknown key %s in config file %s\n", name, path)
+			}
+			continue
+		}
+		switch v := value.(type) {
+		case []interface{}:
+			for _, elt := range v {
+				result[name] = append(result[name], fmt.Sprint(elt))
+			}
+		case map[string]interface{}:
+			for key, elt := range v {
+				result[name] = append(result[name], fmt.Sprintf("%s=%v", key, elt))
+			}
+			sort.Strings(result[name])
+		default:
+			result[name] = []string{fmt.Sprint(v)}
+		}
+	}
+	return result, nil
+}
+
+// setFrom sets values coming from source, validating them as flags are.
+func (op *Option) setFrom(source string, values []string) *XbeeError {
+	if op.isBool {
+		b, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return ConfigError("boolean option %s expects true or false, actual is %s (from %s)", op.Name, values[0], source)
+		}
+		op.Enable(b)
+	} else {
+		for _, value := range values {
+			if err := op.parseValue(value); err != nil {
+				return ConfigError("%s (from %s)", err.message, source)
+			}
+		}
+	}
+	op.source = source
+	return nil
+}
+
+// WithEnvVar reads the value of the option from env var name, if it is not given as a flag.
+func (op *Option) WithEnvVar(name string) *Option {
+	op.envVar = name
+	return op
+}
+
+// Source tells where the value of the option comes from : flag, env, project config, user config or default.
+func (op *Option) Source() string {
+	switch {
+	case op.source != "":
+		return op.source
+	case op.isSet:
+		return SourceFlag
+	default:
+		return SourceDefault
+	}
+}
+
+func (op *Option) displayValue() string {
+	if op.isBool {
+		return strconv.FormatBool(op.booleanValue)
+	}
+	return strings.Join(op.StringValues(), ",")
+}
+
+// knownOptions returns options of all commands of the tree of c, and globals : keys allowed in config files.
+func (c *Command) knownOptions(globals map[string]*Option) map[string]*Option {
+	result := make(map[string]*Option, len(globals))
+	for name, op := range globals {
+		result[name] = op
+	}
+	var walk func(c *Command)
+	walk = func(c *Command) {
+		for _, op := range c.Options {
+			result[op.Name] = op
+		}
+		for _, child := range c.commands {
+			walk(child)
+		}
+	}
+	walk(c)
+	return result
+}
+
+// leaves returns runnable commands of the tree of c, with options, in path order.
+func (c *Command) leaves() (result []*Command) {
+	if c.isRunnable() && len(c.Options) > 0 {
+		result = append(result, c)
+	}
+	children := c.commandsList()
+	sort.Slice(children, func(i, j int) bool { return children[i].Use < children[j].Use })
+	for _, child := range children {
+		if !child.Hidden {
+			result = append(result, child.leaves()...)
+		}
+	}
+	return
+}
+
+// NewConfigCommand creates a command showing the effective value of global options and of options of each
+// command, and where it comes from. Setup and NewApp add it to the root command, unless one is already defined.
+func NewConfigCommand() *Command {
+	c := NewCommand("config")
+	c.Short = "Show the value of options and where it comes from"
+	c.Long = "Show the value of global options and of options of each command, and where it comes from : flag, env var, project or user config file, or default."
+	return c.WithRunE(func(ctx context.Context, _ []string) *XbeeError {
+		w := tabwriter.NewWriter(Stdout(ctx), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "COMMAND\tOPTION\tVALUE\tSOURCE")
+		globals := OptionsFrom(ctx).global
+		var names []string
+		for name := range globals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			op := globals[name]
+			fmt.Fprintf(w, "(global)\t--%s\t%s\t%s\n", op.Name, op.displayValue(), op.Source())
+		}
+		root := c
+		for root.parent != nil {
+			root = root.parent
+		}
+		known := root.knownOptions(globals)
+		for _, leaf := range root.leaves() {
+			// options of other commands are not parsed : they get their value from env vars and config files
+			options := make([]*Option, len(leaf.Options))
+			for i, op := range leaf.Options {
+				options[i] = op.clone()
+			}
+			if err := bindOptions(options, known, io.Discard, UserConfigFile(), ProjectConfigFile()); err != nil {
+				return err
+			}
+			for _, op := range options {
+				fmt.Fprintf(w, "%s\t--%s\t%s\t%s\n", leaf.Path(), op.Name, op.displayValue(), op.Source())
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return Error("cannot display config : %v", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_BindOptions(t *testing.T) {
+	dir := t.TempDir()
+	userFile := filepath.Join(dir, "user.yaml")
+	projectFile := filepath.Join(dir, "project.yaml")
+	if err := os.WriteFile(userFile, []byte("level: warn\ncount: 2\nverbose: true\ntimeout: 1m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(projectFile, []byte("count: 3\nlabel:\n  a: 1\n  b: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XBEE_TEST_LEVEL", "debug")
+	level := NewEnumOption("level", "", "info", "info", "warn", "debug").WithEnvVar("XBEE_TEST_LEVEL")
+	count := NewIntOption("count", "", 1)
+	verbose := NewBooleanOption("verbose", "", false)
+	label := NewMapOption("label", "")
+	timeout := NewDurationOption("timeout", "", 0)
+	other := NewOption("other", "", "x")
+	options := []*Option{level, count, verbose, label, timeout, other}
+	if _, err := NewArgsParser(options).ParseArgs("--timeout=5s"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := bindOptions(options, optionMap(options), io.Discard, userFile, projectFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		option *Option
+		value  string
+		source string
+	}{
+		{timeout, "5s", SourceFlag},
+		{level, "debug", SourceEnv + " XBEE_TEST_LEVEL"},
+		{count, "3", SourceProjectConfig + " " + projectFile},
+		{label, "a=1,b=2", SourceProjectConfig + " " + projectFile},
+		{verbose, "true", SourceUserConfig + " " + userFile},
+		{other, "x", SourceDefault},
+	}
+	for _, tt := range tests {
+		if tt.option.displayValue() != tt.value || tt.option.Source() != tt.source {
+			t.Errorf("option %s: expected %s from %s, actual is %s from %s", tt.option.Name, tt.value, tt.source, tt.option.displayValue(), tt.option.Source())
+		}
+		if tt.option.IsSet() != (tt.source != SourceDefault) {
+			t.Errorf("option %s: unexpected IsSet %v", tt.option.Name, tt.option.IsSet())
+		}
+	}
+}
+
+func Test_BindOptionsInvalid(t *testing.T) {
+	t.Setenv("XBEE_TEST_COUNT", "many")
+	count := NewIntOption("count", "", 1).WithEnvVar("XBEE_TEST_COUNT")
+	err := bindOptions([]*Option{count}, nil, io.Discard, "", "")
+	if err == nil || err.message != "option --count expects an integer, actual is many (from env XBEE_TEST_COUNT)" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_ConfigCommandAndUnknownKeys(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".xbee"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(home, ".xbee", "config.yaml")
+	if err := os.WriteFile(config, []byte("name: xbee\ndry-run: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out, errOut bytes.Buffer
+	app := NewApp(appTree())
+	app.Stdout, app.Stderr = &out, &errOut
+	if err := app.Execute(context.Background(), []string{"config"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	output := strings.Join(strings.Fields(out.String()), " ")
+	for _, expected := range []string{"(global) --dry-run true user config " + config, "greet --name xbee user config " + config, "greet --loud false default"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in config output, actual is\n%s", expected, out.String())
+		}
+	}
+
+	// keys of other programs sharing the config file do not prevent commands from running
+	if err := os.WriteFile(config, []byte("nme: xbee\nparallel: 4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := app.Execute(context.Background(), []string{"greet"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if out.String() != "world false []" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	for _, expected := range []string{"unknown key nme in config file " + config + ", did you mean name ?", "unknown key parallel in config file " + config + "\n"} {
+		if !strings.Contains(errOut.String(), expected) {
+			t.Errorf("expected warning %q, actual warnings are %q", expected, errOut.String())
+		}
+	}
+}
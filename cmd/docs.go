@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GenManTree writes a man page (roff, section 1) for each visible command of the tree of root into dir.
+func GenManTree(root *Command, dir string) *XbeeError {
+	return genTree(root, dir, ".1", manPage)
+}
+
+// GenMarkdownTree writes a Markdown reference page for each visible command of the tree of root into dir.
+func GenMarkdownTree(root *Command, dir string) *XbeeError {
+	return genTree(root, dir, ".md", markdownPage)
+}
+
+func genTree(root *Command, dir string, extension string, page func(c *Command) string) *XbeeError {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Error("cannot create folder %s : %v", dir, err)
+	}
+	var err *XbeeError
+	root.walk(func(c *Command) {
+		if err != nil {
+			return
+		}
+		path := filepath.Join(dir, c.docName()+extension)
+		if err2 := os.WriteFile(path, []byte(page(c)), 0644); err2 != nil {
+			err = Error("cannot write %s : %v", path, err2)
+		}
+	})
+	return err
+}
+
+// walk calls f on c and its visible sub commands, in name order.
+func (c *Command) walk(f func(c *Command)) {
+	f(c)
+	for _, child := range c.sortedChildren() {
+		child.walk(f)
+	}
+}
+
+func (c *Command) sortedChildren() (result []*Command) {
+	for _, child := range c.notHidden() {
+		result = append(result, child)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Use < result[j].Use })
+	describe(result)
+	return
+}
+
+// commandLine returns the program name followed by the path of c.
+func (c *Command) commandLine() string {
+	return strings.TrimSpace(programName + " " + c.Path())
+}
+
+// docName is the base name of the doc page of c, like xbee-volume-delete.
+func (c *Command) docName() string {
+	return strings.ReplaceAll(c.commandLine(), " ", "-")
+}
+
+func (c *Command) synopsis() string {
+	if !c.isRunnable() {
+		return c.commandLine() + " COMMAND"
+	}
+	return c.commandLine() + " [OPTIONS] [ARG...]"
+}
+
+// typeLabel returns the type of values of the option, as shown in reference docs.
+func (op *Option) typeLabel() string {
+	switch {
+	case op.isBool:
+		return "bool"
+	case op.typeName != "":
+		return op.typeName
+	default:
+		return "string"
+	}
+}
+
+func (op *Option) defaultLabel() string {
+	if op.isBool {
+		return strconv.FormatBool(op.defaultBooleanValue)
+	}
+	return op.defaultStringValue
+}
+
+func (op *Option) descriptionLabel() string {
+	description := op.Description
+	if len(op.allowed) > 0 {
+		description = strings.TrimSpace(description + " (one of " + strings.Join(op.allowed, ", ") + ")")
+	}
+	return description
+}
+
+func manPage(c *Command) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, ".TH %q \"1\" \"\" %q %q\n", strings.ToUpper(c.docName()), programName, programName+" Manual")
+	sb.WriteString(".SH NAME\n")
+	fmt.Fprintf(&sb, "%s \\- %s\n", roffEscape(c.docName()), roffEscape(c.Short))
+	sb.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(&sb, ".B %s\n", roffEscape(c.synopsis()))
+	if c.Long != "" || c.Short != "" {
+		sb.WriteString(".SH DESCRIPTION\n")
+		sb.WriteString(roffText(firstNonEmpty(c.Long, c.Short)))
+	}
+	if len(c.Aliases) > 0 {
+		sb.WriteString(".SH ALIASES\n")
+		sb.WriteString(roffText(strings.Join(c.Aliases, ", ")))
+	}
+	if children := c.sortedChildren(); len(children) > 0 {
+		sb.WriteString(".SH COMMANDS\n")
+		for _, child := range children {
+			fmt.Fprintf(&sb, ".TP\n.B %s\n%s", roffEscape(child.Use), roffText(child.Short))
+		}
+	}
+	if len(c.Options) > 0 {
+		sb.WriteString(".SH OPTIONS\n")
+		manOptions(&sb, c.Options)
+	}
+	sb.WriteString(".SH GLOBAL OPTIONS\n")
+	manOptions(&sb, sortedGlobalOptions())
+	if c.Example != "" {
+		sb.WriteString(".SH EXAMPLES\n.nf\n")
+		sb.WriteString(roffText(c.Example))
+		sb.WriteString(".fi\n")
+	}
+	if related := c.related(); len(related) > 0 {
+		sb.WriteString(".SH SEE ALSO\n")
+		var refs []string
+		for _, r := range related {
+			refs = append(refs, fmt.Sprintf(".BR %s (1)", roffEscape(r.docName())))
+		}
+		sb.WriteString(strings.Join(refs, ",\n") + "\n")
+	}
+	return sb.String()
+}
+
+func manOptions(sb *strings.Builder, options []*Option) {
+	for _, op := range options {
+		names := "--" + op.Name
+		if op.ShortHand != "" {
+			names = "-" + op.ShortHand + ", " + names
+		}
+		if !op.isBool {
+			names += " " + op.typeLabel()
+		}
+		fmt.Fprintf(sb, ".TP\n.B %s\n", roffEscape(names))
+		description := op.descriptionLabel()
+		if def := op.defaultLabel(); def != "" {
+			description = strings.TrimSpace(description + " (default: " + def + ")")
+		}
+		sb.WriteString(roffText(description))
+	}
+}
+
+// roffEscape escapes backslashes and dashes of a roff line.
+func roffEscape(s string) string {
+	return strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+}
+
+// roffText escapes s, and protects lines starting with a control character.
+func roffText(s string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		line = roffEscape(line)
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			line = `\&` + line
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+func markdownPage(c *Command) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", c.commandLine())
+	if c.Short != "" {
+		sb.WriteString(c.Short + "\n\n")
+	}
+	sb.WriteString("## Synopsis\n\n")
+	fmt.Fprintf(&sb, "```\n%s\n```\n\n", c.synopsis())
+	if c.Long != "" {
+		sb.WriteString(strings.TrimSpace(c.Long) + "\n\n")
+	}
+	if len(c.Aliases) > 0 {
+		fmt.Fprintf(&sb, "**Aliases:** %s\n\n", strings.Join(c.Aliases, ", "))
+	}
+	if children := c.sortedChildren(); len(children) > 0 {
+		sb.WriteString("## Commands\n\n")
+		for _, child := range children {
+			fmt.Fprintf(&sb, "* [%s](%s.md) - %s\n", child.Use, child.docName(), child.Short)
+		}
+		sb.WriteString("\n")
+	}
+	if len(c.Options) > 0 {
+		sb.WriteString("## Options\n\n")
+		markdownOptions(&sb, c.Options)
+	}
+	sb.WriteString("## Global options\n\n")
+	markdownOptions(&sb, sortedGlobalOptions())
+	if c.Example != "" {
+		fmt.Fprintf(&sb, "## Examples\n\n```\n%s\n```\n\n", strings.TrimRight(c.Example, "\n"))
+	}
+	if related := c.related(); len(related) > 0 {
+		sb.WriteString("## See also\n\n")
+		for _, r := range related {
+			fmt.Fprintf(&sb, "* [%s](%s.md) - %s\n", r.commandLine(), r.docName(), r.Short)
+		}
+	}
+	return sb.String()
+}
+
+func markdownOptions(sb *strings.Builder, options []*Option) {
+	sb.WriteString("| Option | Type | Default | Description |\n")
+	sb.WriteString("|--------|------|---------|-------------|\n")
+	for _, op := range options {
+		names := "`--" + op.Name + "`"
+		if op.ShortHand != "" {
+			names = "`-" + op.ShortHand + "`, " + names
+		}
+		def := op.defaultLabel()
+		if def != "" {
+			def = "`" + def + "`"
+		}
+		fmt.Fprintf(sb, "| %s | %s | %s | %s |\n", names, op.typeLabel(), def, strings.ReplaceAll(op.descriptionLabel(), "|", `\|`))
+	}
+	sb.WriteString("\n")
+}
+
+// related returns the parent of c, shown in SEE ALSO sections.
+func (c *Command) related() (result []*Command) {
+	if c.parent != nil {
+		result = append(result, c.parent)
+	}
+	return
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_GenDocs(t *testing.T) {
+	SetProgramName("xbee-test")
+	defer SetProgramName("xbee")
+	root := completionTree()
+	up := root.child("up")
+	up.Short = "Start hosts"
+	up.Example = "  xbee-test up --env prod"
+	dir := t.TempDir()
+	if err := GenManTree(root, dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := GenMarkdownTree(root, dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"xbee-test.1", "xbee-test-up.1", "xbee-test-volume-delete.1", "xbee-test.md", "xbee-test-volume-delete.md"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("page %s not generated", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "xbee-test-secret.md")); err == nil {
+		t.Errorf("page of hidden command generated")
+	}
+	man, _ := os.ReadFile(filepath.Join(dir, "xbee-test-up.1"))
+	for _, expected := range []string{`xbee\-test\-up \- Start hosts`, `.B \-e, \-\-env enum`, "(one of dev, prod) (default: dev)", ".SH EXAMPLES", ".SH GLOBAL OPTIONS"} {
+		if !strings.Contains(string(man), expected) {
+			t.Errorf("man page does not contain %q:\n%s", expected, man)
+		}
+	}
+	md, _ := os.ReadFile(filepath.Join(dir, "xbee-test-up.md"))
+	for _, expected := range []string{"# xbee-test up", "| `-f`, `--force` | bool | `false` |", "xbee-test up --env prod", "* [xbee-test](xbee-test.md)"} {
+		if !strings.Contains(string(md), expected) {
+			t.Errorf("markdown page does not contain %q:\n%s", expected, md)
+		}
+	}
+}
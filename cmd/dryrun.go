@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var dryRunOption = NewBooleanOption("dry-run", "", false).WithDescription("Show side effects instead of doing them, with a summary at the end").WithEnvVar("XBEE_DRY_RUN")
+
+// planned keeps side effects planned outside of any execution, for instance by tests.
+var planned plan
+
+type plan struct {
+	lock    sync.Mutex
+	actions []string
+}
+
+func init() {
+	Register(dryRunOption)
+}
+
+// IsDryRun returns true if side effects of the command run with ctx must only be shown, with Plan.
+func IsDryRun(ctx context.Context) bool { return parsed(ctx, dryRunOption).BooleanValue() }
+
+// Plan shows a side effect skipped in dry run on the stdout of the App running ctx, and keeps it for the summary.
+func Plan(ctx context.Context, format string, args ...interface{}) {
+	action := fmt.Sprintf(format, args...)
+	p := planOf(ctx)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.actions = append(p.actions, action)
+	fmt.Fprintf(Stdout(ctx), "[dry-run] would %s\n", action)
+}
+
+// planOf returns the plan of the execution of ctx : each execution starts with an empty plan.
+func planOf(ctx context.Context) *plan {
+	if e := executionFrom(ctx); e != nil {
+		return &e.planned
+	}
+	return &planned
+}
+
+// PlannedActions returns side effects skipped in dry run by the command run with ctx, in order.
+func PlannedActions(ctx context.Context) []string {
+	p := planOf(ctx)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.actions...)
+}
+
+// DryRunSummary returns side effects planned by the command run with ctx, one per line.
+func DryRunSummary(ctx context.Context) string {
+	actions := PlannedActions(ctx)
+	if len(actions) == 0 {
+		return "Dry run : no side effect planned\n"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Dry run : %d side effect(s) planned\n", len(actions))
+	for i, action := range actions {
+		fmt.Fprintf(&sb, "%3d. %s\n", i+1, action)
+	}
+	return sb.String()
+}
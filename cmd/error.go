@@ -2,29 +2,62 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"runtime"
 	"strings"
 )
 
-var stackOption = NewBooleanOption("stack", "", false).WithDescription("If an unexpected error occurs, turn on this flag to display stack trace")
+var stackOption = NewBooleanOption("stack", "", false).WithDescription("If an unexpected error occurs, turn on this flag to display stack trace").WithEnvVar("XBEE_STACK")
 
 func init() {
 	Register(stackOption)
 }
 
+// Error formats a message like fmt.Errorf : errors given with %w are wrapped, and reachable by errors.Is and
+// errors.As.
 func Error(format string, args ...interface{}) *XbeeError {
 	var stack string
 	if IsStackEnabled() {
 		stack = generateStack()
 	}
+	err := fmt.Errorf(format, args...)
 	return &XbeeError{
-		message:            fmt.Sprintf(format, args...),
+		message:            err.Error(),
+		wrapped:            unwrapped(err),
 		stack:              stack,
 		skipFirstLineCount: 5,
 	}
 }
 
+func unwrapped(err error) []error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return []error{e.Unwrap()}
+	case interface{ Unwrap() []error }:
+		return e.Unwrap()
+	}
+	return nil
+}
+
+// ErrorWithCause formats a message caused by cause, shown under CAUSED BY. A standard error is wrapped in an
+// XbeeError, and stays reachable by errors.Is and errors.As.
+func ErrorWithCause(cause error, format string, args ...interface{}) *XbeeError {
+	err := Error(format, args...)
+	err.SkipFirst(7)
+	if cause == nil {
+		return err
+	}
+	origin, ok := cause.(*XbeeError)
+	if !ok {
+		origin = &XbeeError{message: cause.Error(), wrapped: []error{cause}}
+	}
+	if origin != nil {
+		err.origins = append(err.origins, origin)
+	}
+	return err
+}
+
 // CauseBy should be used in stacked go routines
 func CauseBy(origins ...*XbeeError) *XbeeError {
 	var stack string
@@ -73,7 +106,10 @@ func generateStack() string {
 }
 
 type XbeeError struct {
-	code               int
+	code               int // exit code, overriding the one of category
+	category           Category
+	fields             []Field
+	wrapped            []error // errors given with %w
 	message            string
 	stack              string
 	skipFirstLineCount int
@@ -98,6 +134,17 @@ func (xe *XbeeError) Code() int {
 	return xe.code
 }
 
+// Unwrap returns errors wrapped with %w, then causes and following errors, for errors.Is and errors.As.
+func (xe *XbeeError) Unwrap() []error {
+	result := append([]error{}, xe.wrapped...)
+	for _, errs := range [][]*XbeeError{xe.origins, xe.follows} {
+		for _, e := range errs {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
 func (xe *XbeeError) Error() string {
 	var buf bytes.Buffer
 	if xe.message != "" {
@@ -105,6 +152,9 @@ func (xe *XbeeError) Error() string {
 		buf.WriteString(xe.message)
 		buf.WriteByte('\n')
 	}
+	for _, field := range xe.fields {
+		buf.WriteString(field.Key + "=" + field.Value + "\n")
+	}
 	if xe.stack != "" {
 		buf.WriteString("stack=[\n")
 		buf.WriteString(xe.trimStack())
@@ -154,4 +204,9 @@ func (xe *XbeeError) trimStack() string {
 	return output
 }
 
-func IsStackEnabled() bool { return stackOption.BooleanValue() }
+// IsStackEnabled returns true if --stack was given to the command parsed by Setup, or to the Run leaf being
+// executed by an App. Errors, created without ctx, get a stack then.
+func IsStackEnabled() bool { return IsStackEnabledContext(nil) }
+
+// IsStackEnabledContext returns true if --stack was given to the command run with ctx.
+func IsStackEnabledContext(ctx context.Context) bool { return parsed(ctx, stackOption).BooleanValue() }
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var errorFormatOption = NewEnumOption("error-format", "", "text", "text", "json", "yaml").
+	WithDescription("Format of errors displayed on exit, json and yaml being for machine consumers").
+	WithEnvVar("XBEE_ERROR_FORMAT")
+
+func init() {
+	Register(errorFormatOption)
+}
+
+// Field is a key/value describing the context of an error, like the host or the file concerned.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// WithField adds key=value to the context of xe, replacing a previous value of key.
+func (xe *XbeeError) WithField(key string, value string) *XbeeError {
+	for i := range xe.fields {
+		if xe.fields[i].Key == key {
+			xe.fields[i].Value = value
+			return xe
+		}
+	}
+	xe.fields = append(xe.fields, Field{Key: key, Value: value})
+	return xe
+}
+
+func (xe *XbeeError) WithHost(host string) *XbeeError       { return xe.WithField("host", host) }
+func (xe *XbeeError) WithFile(file string) *XbeeError       { return xe.WithField("file", file) }
+func (xe *XbeeError) WithCommand(command string) *XbeeError { return xe.WithField("command", command) }
+
+// Field returns the value of key, found in xe or else in its causes.
+func (xe *XbeeError) Field(key string) string {
+	for _, field := range xe.fields {
+		if field.Key == key {
+			return field.Value
+		}
+	}
+	for _, origin := range xe.origins {
+		if value := origin.Field(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// ErrorNode is an XbeeError as rendered in json or yaml.
+type ErrorNode struct {
+	Message  string            `json:"message,omitempty" yaml:"message,omitempty"`
+	Category Category          `json:"category,omitempty" yaml:"category,omitempty"`
+	Code     int               `json:"code,omitempty" yaml:"code,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty" yaml:"fields,omitempty"`
+	Stack    string            `json:"stack,omitempty" yaml:"stack,omitempty"`
+	CausedBy []*ErrorNode      `json:"causedBy,omitempty" yaml:"causedBy,omitempty"`
+	Follows  []*ErrorNode      `json:"follows,omitempty" yaml:"follows,omitempty"`
+}
+
+// Tree returns the error tree of xe : causes and following errors are children.
+func (xe *XbeeError) Tree() *ErrorNode {
+	node := &ErrorNode{
+		Message:  xe.message,
+		Category: xe.category,
+		Code:     xe.code,
+		Stack:    xe.trimStack(),
+	}
+	if len(xe.fields) > 0 {
+		node.Fields = make(map[string]string, len(xe.fields))
+		for _, field := range xe.fields {
+			node.Fields[field.Key] = field.Value
+		}
+	}
+	for _, origin := range xe.origins {
+		node.CausedBy = append(node.CausedBy, origin.Tree())
+	}
+	for _, follow := range xe.follows {
+		node.Follows = append(node.Follows, follow.Tree())
+	}
+	return node
+}
+
+// Render returns xe as indented text, json or yaml. Unknown formats render as text.
+func (xe *XbeeError) Render(format string) string {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(xe.Tree(), "", "  ")
+		if err != nil { //should not occur
+			return xe.Error()
+		}
+		return string(data) + "\n"
+	case "yaml":
+		data, err := yaml.Marshal(xe.Tree())
+		if err != nil { //should not occur
+			return xe.Error()
+		}
+		return string(data)
+	}
+	var sb strings.Builder
+	xe.renderText(&sb, "")
+	return sb.String()
+}
+
+func (xe *XbeeError) renderText(sb *strings.Builder, indent string) {
+	if xe.message != "" {
+		for _, line := range strings.Split(strings.TrimRight(xe.message, "\n"), "\n") {
+			sb.WriteString(indent + line + "\n")
+		}
+	}
+	for _, field := range xe.fields {
+		sb.WriteString(indent + "  " + field.Key + ": " + field.Value + "\n")
+	}
+	if stack := xe.trimStack(); stack != "" {
+		for _, line := range strings.Split(strings.TrimRight(stack, "\n"), "\n") {
+			sb.WriteString(indent + "  | " + line + "\n")
+		}
+	}
+	if len(xe.origins) > 0 {
+		sb.WriteString(indent + "CAUSED BY\n")
+	}
+	for _, origin := range xe.origins {
+		origin.renderText(sb, indent+"  ")
+	}
+	if len(xe.follows) > 0 {
+		sb.WriteString(indent + "FOLLOWS\n")
+	}
+	for _, follow := range xe.follows {
+		follow.renderText(sb, indent+"  ")
+	}
+}
+
+// ErrorFormat returns the format chosen with --error-format for the command run with ctx : text, json or yaml.
+func ErrorFormat(ctx context.Context) string { return parsed(ctx, errorFormatOption).StringValue() }
+
+// RenderError returns err in the format chosen with --error-format for the command run with ctx.
+func RenderError(ctx context.Context, err *XbeeError) string {
+	return err.Render(ErrorFormat(ctx))
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func errorTree() *XbeeError {
+	copyErr := Error("copy a -> b: %w", os.ErrPermission).WithFile("b")
+	cause := ErrorWithCause(os.ErrNotExist, "cannot read env.yaml").WithHost("web1")
+	err := CauseBy(copyErr, cause)
+	err.follows = []*XbeeError{NotFoundError("cleanup failed")}
+	return err
+}
+
+func Test_ErrorUnwrap(t *testing.T) {
+	err := errorTree()
+	if !errors.Is(err, os.ErrPermission) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("wrapped errors must be reachable with errors.Is")
+	}
+	if errors.Is(err, os.ErrClosed) {
+		t.Errorf("unexpected error found")
+	}
+	if !Is(err.follows[0], CategoryNotFound) || err.Field("host") != "web1" {
+		t.Errorf("expected category and host of causes")
+	}
+}
+
+func Test_ErrorRender(t *testing.T) {
+	err := errorTree()
+	expectedText := `CAUSED BY
+  copy a -> b: permission denied
+    file: b
+  cannot read env.yaml
+    host: web1
+  CAUSED BY
+    file does not exist
+FOLLOWS
+  cleanup failed
+`
+	if actual := err.Render("text"); actual != expectedText {
+		t.Errorf("expected\n%s\nactual is\n%s", expectedText, actual)
+	}
+	expectedYaml := `causedBy:
+    - message: 'copy a -> b: permission denied'
+      fields:
+        file: b
+    - message: cannot read env.yaml
+      fields:
+        host: web1
+      causedBy:
+        - message: file does not exist
+follows:
+    - message: cleanup failed
+      category: not-found
+`
+	if actual := err.Render("yaml"); actual != expectedYaml {
+		t.Errorf("expected\n%s\nactual is\n%s", expectedYaml, actual)
+	}
+	expectedJson := `{
+  "message": "cleanup failed",
+  "category": "not-found"
+}
+`
+	if actual := err.follows[0].Render("json"); actual != expectedJson {
+		t.Errorf("expected\n%s\nactual is\n%s", expectedJson, actual)
+	}
+}
@@ -1,25 +1,39 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
 
 func NewForceOption() *Option { return NewBooleanOption("force", "f", false) }
 
+// Force returns true if the command run by the default App was given --force.
 func Force() bool {
-	if HasOption("force") {
-		return OptionFrom("force").BooleanValue()
+	return ForceContext(nil)
+}
+
+// ForceContext returns true if the command run with ctx was given --force.
+func ForceContext(ctx context.Context) bool {
+	if options := OptionsFrom(ctx); options.Has("force") {
+		return options.Get("force").BooleanValue()
 	}
 	return false
 }
 
+// Confirm asks the user to confirm message, unless --force is given to the command run by the default App.
 func Confirm(message string) bool {
-	if !Force() {
+	return ConfirmContext(nil, message)
+}
+
+// ConfirmContext asks the user to confirm message on the stdin and stdout of the App running ctx, unless --force
+// is given.
+func ConfirmContext(ctx context.Context, message string) bool {
+	if !ForceContext(ctx) {
 		for {
 			var shouldDoS string
-			fmt.Printf("Confirm %s ? [y,n]: ", message)
-			if _, err := fmt.Scanln(&shouldDoS); err != nil {
+			fmt.Fprintf(Stdout(ctx), "Confirm %s ? [y,n]: ", message)
+			if _, err := fmt.Fscanln(Stdin(ctx), &shouldDoS); err != nil {
 				panic(fmt.Errorf("unexpected error while typing : %v", err))
 			}
 			if strings.ToLower(shouldDoS) == "y" {
@@ -27,7 +41,7 @@ func Confirm(message string) bool {
 			} else if strings.ToLower(shouldDoS) == "n" {
 				return false
 			} else {
-				fmt.Println("Sorry, i do not understand")
+				fmt.Fprintln(Stdout(ctx), "Sorry, i do not understand")
 			}
 		}
 	}
@@ -37,31 +37,68 @@ func NewOption(name string, shorthand string, defaultValue string) *Option {
 }
 func NewBooleanOption(name string, shorthand string, defaultValue bool) *Option {
 	return &Option{
-		Name:         name,
-		ShortHand:    shorthand,
-		isBool:       true,
-		booleanValue: defaultValue,
+		Name:                name,
+		ShortHand:           shorthand,
+		isBool:              true,
+		booleanValue:        defaultValue,
+		defaultBooleanValue: defaultValue,
 	}
 }
 
 type Option struct {
-	ShortHand          string //one-letter
-	Name               string
-	isBool             bool
-	Description        string
-	booleanValue       bool //set at parse time
-	defaultStringValue string
-	stringValues       []string //set at parse time
-	isSet              bool
+	ShortHand           string //one-letter
+	Name                string
+	isBool              bool
+	Description         string
+	booleanValue        bool //set at parse time
+	defaultBooleanValue bool
+	defaultStringValue  string
+	stringValues        []string //set at parse time
+	isSet               bool
+
+	typeName       string // shown in usage
+	allowed        []string
+	validate       func(value string) *XbeeError
+	commaSeparated bool
+
+	envVar string
+	source string // set when the value does not come from a flag
+
+	// Complete returns candidates for a value of the option, enum values being completed by default.
+	Complete func(toComplete string) []string
+}
+
+// clone returns a copy of op, not parsed yet.
+func (op *Option) clone() *Option {
+	c := *op
+	c.booleanValue = op.defaultBooleanValue
+	c.stringValues = nil
+	c.isSet = false
+	c.source = ""
+	return &c
 }
 
 func (op *Option) BooleanValue() bool {
 	return op.booleanValue
 }
 func (op *Option) computeShortNameNameLength() int {
-	return 5 + len(op.Name)
+	return 5 + len(op.Name) + len(op.typeHint())
+}
+
+// typeHint returns the type of values shown in usage, like " <int>".
+func (op *Option) typeHint() string {
+	if op.typeName == "" {
+		return ""
+	}
+	return " <" + op.typeName + ">"
 }
+
+// StringValue returns the value given, or the default value. A repeated typed option returns its last value, as
+// GNU tools do, other options their first value.
 func (op *Option) StringValue() string {
+	if len(op.stringValues) > 0 && op.typeName != "" {
+		return op.stringValues[len(op.stringValues)-1]
+	}
 	if len(op.stringValues) > 0 {
 		return op.stringValues[0]
 	}
@@ -87,6 +124,8 @@ func (op *Option) IsArgForMe(arg string) bool {
 	}
 	return arg == fmt.Sprintf("--%s", op.Name)
 }
+
+// IsSet returns true if a value was explicitly given, as a flag, an env var or in a config file. See Source.
 func (op *Option) IsSet() bool {
 	return op.isSet
 }
@@ -111,6 +150,11 @@ func (op *Option) SetStringValue(newValue string) *XbeeError {
 	if op.isBool {
 		return Error("cannot set string value to boolean option %s\n", op.Name)
 	}
+	if op.validate != nil {
+		if err := op.validate(newValue); err != nil {
+			return err
+		}
+	}
 	op.stringValues = []string{newValue}
 	return nil
 }
@@ -150,12 +194,15 @@ func displayOptions(options []*Option) (result string) {
 		if option.ShortHand != "" {
 			s = "\n -" + option.ShortHand
 		}
-		s += " --" + option.Name
+		s += " --" + option.Name + option.typeHint()
 		nbSpace := columnIndexForDescription - option.computeShortNameNameLength()
 		for i := 0; i < nbSpace; i++ {
 			s += " "
 		}
 		s += option.Description
+		if len(option.allowed) > 0 {
+			s += " (one of " + strings.Join(option.allowed, ", ") + ")"
+		}
 		result += s
 	}
 	return
@@ -1,32 +1,23 @@
 package cmd
 
-import (
-	"sync"
-)
-
-var options struct {
-	Map  map[string]*Option
-	once sync.Once
-}
-
-func initOptions() {
-	options.once.Do(func() {
-		options.Map = make(map[string]*Option)
-		if leaf != nil {
-			for _, option := range leaf.Options {
-				options.Map[option.Name] = option
-			}
-		}
-	})
-}
+import "context"
 
+// HasOption returns true if the command parsed by Setup, or the Run leaf being executed by an App, has an
+// option named key. Commands run with RunE use OptionsFrom.
 func HasOption(key string) bool {
-	initOptions()
-	_, ok := options.Map[key]
-	return ok
+	return OptionsFrom(context.Background()).Has(key)
 }
 
+// OptionFrom returns the option named key of the command parsed by Setup, or of the Run leaf being executed by
+// an App. Commands run with RunE use OptionsFrom.
 func OptionFrom(key string) *Option {
-	initOptions()
-	return options.Map[key]
+	return OptionsFrom(context.Background()).Get(key)
+}
+
+// parsed returns option as parsed for the command run with ctx, option itself outside of any execution.
+func parsed(ctx context.Context, option *Option) *Option {
+	if op := OptionsFrom(ctx).Get(option.Name); op != nil {
+		return op
+	}
+	return option
 }
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PluginPrefix is the prefix of plugin executables : xbee-foo is mounted as command foo.
+const PluginPrefix = "xbee-"
+
+// pluginMetadataCommandName is the hidden command of plugins printing their PluginMetadata as json.
+const pluginMetadataCommandName = "__plugin-metadata"
+
+// pluginMetadataTimeout bounds the time a plugin takes to give its metadata.
+const pluginMetadataTimeout = 2 * time.Second
+
+// PluginMetadata describes a plugin, as printed by its hidden metadata command.
+type PluginMetadata struct {
+	Name    string `json:"name"`
+	Short   string `json:"short"`
+	Version string `json:"version"`
+}
+
+// Plugin is an xbee-<name> executable found in the plugins folder or on PATH.
+type Plugin struct {
+	PluginMetadata
+	Path string
+
+	once sync.Once // metadata are loaded once
+}
+
+// PluginsFolder returns ~/.xbee/plugins.
+func PluginsFolder() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".xbee", "plugins")
+}
+
+// NewPluginMetadataCommand returns the hidden command a plugin adds to its tree, so that xbee describes it.
+func NewPluginMetadataCommand(short string, version string) *Command {
+	return &Command{
+		Use:    pluginMetadataCommandName,
+		Hidden: true,
+		RunE: func(ctx context.Context, _ []string) *XbeeError {
+			name := strings.TrimPrefix(programName, PluginPrefix)
+			data, err := json.Marshal(PluginMetadata{Name: name, Short: short, Version: version})
+			if err != nil { //should not occur
+				return InternalError("cannot marshal metadata of plugin %s : %v", name, err)
+			}
+			fmt.Fprintln(Stdout(ctx), string(data))
+			return nil
+		},
+	}
+}
+
+// DiscoverPlugins finds plugin executables in the plugins folder, then in PATH folders. For a given name, the
+// first one found wins. Metadata are not queried yet.
+func DiscoverPlugins() []*Plugin {
+	folders := append([]string{PluginsFolder()}, filepath.SplitList(os.Getenv("PATH"))...)
+	found := map[string]*Plugin{}
+	for _, folder := range folders {
+		if folder == "" {
+			continue
+		}
+		entries, err := os.ReadDir(folder)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(strings.TrimSuffix(entry.Name(), ".exe"), PluginPrefix)
+			if !ok || name == "" || found[name] != nil {
+				continue
+			}
+			path := filepath.Join(folder, entry.Name())
+			if info, err := os.Stat(path); err == nil && !info.IsDir() && isExecutable(path, info) {
+				found[name] = &Plugin{Path: path, PluginMetadata: PluginMetadata{Name: name}}
+			}
+		}
+	}
+	var result []*Plugin
+	for _, p := range found {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// loadMetadata asks the plugin for its metadata. The name of a plugin is always the one of its executable.
+func (p *Plugin) loadMetadata(ctx context.Context) *XbeeError {
+	ctx, cancel := context.WithTimeout(ctx, pluginMetadataTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, p.Path, pluginMetadataCommandName).Output()
+	if err != nil {
+		return Error("cannot get metadata of plugin %s : %w", p.Path, err).WithCommand(p.Path)
+	}
+	var metadata PluginMetadata
+	if err := json.Unmarshal(out, &metadata); err != nil {
+		return Error("plugin %s gave invalid metadata : %w", p.Path, err).WithCommand(p.Path)
+	}
+	p.Short, p.Version = metadata.Short, metadata.Version
+	return nil
+}
+
+// AddPlugins mounts plugins found by DiscoverPlugins as sub commands of root, built-in commands winning over
+// plugins. Plugins are not run : their metadata are queried only when usage or docs display them ; a plugin
+// without metadata is still mounted.
+// Setup and NewApp do not call AddPlugins : the main program calls it on its root, for instance in the function
+// given to Setup, and plugins themselves do not.
+func AddPlugins(root *Command) *XbeeError {
+	for _, p := range DiscoverPlugins() {
+		if root.child(p.Name) != nil {
+			continue
+		}
+		if err := root.AddCommands(p.command()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) command() *Command {
+	c := &Command{
+		Use:         p.Name,
+		passThrough: true,
+		RunE:        p.run,
+	}
+	c.Short = p.short()
+	c.Long = c.Short
+	c.describe = func() {
+		p.once.Do(func() {
+			_ = p.loadMetadata(context.Background())
+			c.Short = p.short()
+			c.Long = c.Short
+		})
+	}
+	return c
+}
+
+func (p *Plugin) short() string {
+	short := p.Short
+	if short == "" {
+		short = "external command " + p.Path
+	}
+	if p.Version != "" {
+		short += " (plugin " + p.Version + ")"
+	}
+	return short
+}
+
+// run executes the plugin with XbeeFlags then args, sharing stdio of the App. The exit code of the plugin is
+// the code of the error returned.
+func (p *Plugin) run(ctx context.Context, args []string) *XbeeError {
+	c := exec.CommandContext(ctx, p.Path, append(XbeeFlagsFrom(ctx), args...)...)
+	c.Stdin, c.Stdout, c.Stderr = Stdin(ctx), Stdout(ctx), Stderr(ctx)
+	// the plugin is asked to stop when ctx is cancelled, and is given time to stop gracefully before being killed
+	c.Cancel = func() error { return terminate(c.Process) }
+	c.WaitDelay = 10 * time.Second
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		xe := Error("plugin %s exited with code %d", p.Name, exitErr.ExitCode()).WithCommand(p.Path)
+		xe.code = max(exitErr.ExitCode(), 1)
+		return xe
+	}
+	if err != nil {
+		return Error("cannot run plugin %s : %w", p.Path, err).WithCommand(p.Path)
+	}
+	return nil
+}
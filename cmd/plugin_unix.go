@@ -0,0 +1,17 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+func isExecutable(_ string, info os.FileInfo) bool {
+	return info.Mode()&0111 != 0
+}
+
+// terminate asks process to stop, with SIGTERM.
+func terminate(process *os.Process) error {
+	return process.Signal(syscall.SIGTERM)
+}
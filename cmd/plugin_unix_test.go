@@ -0,0 +1,96 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const helloPlugin = `#!/bin/sh
+if [ "$1" = "__plugin-metadata" ]; then
+  touch "$METADATA_MARKER"
+  echo '{"name":"hello","short":"Say hello","version":"1.2.0"}'
+  exit 0
+fi
+echo "hello $*"
+[ "$1" = "--xbeeDebug" ] && exit 3
+exit 0
+`
+
+func Test_Plugins(t *testing.T) {
+	home := t.TempDir()
+	bin := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PATH", bin)
+	marker := filepath.Join(home, "metadata-loaded")
+	t.Setenv("METADATA_MARKER", marker)
+	writePlugin(t, filepath.Join(home, ".xbee", "plugins"), "xbee-hello", helloPlugin)
+	writePlugin(t, bin, "xbee-hello", "#!/bin/sh\necho shadowed\n")
+	writePlugin(t, bin, "xbee-up", "#!/bin/sh\necho built-in wins\n")
+	if err := os.WriteFile(filepath.Join(bin, "xbee-notexecutable"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root := appTree()
+	_ = root.AddCommands(NewCommand("up").WithRun(func([]string) *XbeeError { return nil }))
+	if err := AddPlugins(root); err != nil {
+		t.Fatal(err)
+	}
+	if c := root.child("notexecutable"); c != nil {
+		t.Errorf("not executable files are not plugins")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("metadata must be loaded only when usage is displayed")
+	}
+	if usage, _ := root.AvailableSubCommandsToDisplay(); !strings.Contains(usage, "hello: Say hello (plugin 1.2.0)") {
+		t.Errorf("expected plugin in usage, actual is %s", usage)
+	}
+
+	var out bytes.Buffer
+	app := NewApp(root)
+	app.Stdout = &out
+	if err := app.Execute(context.Background(), []string{"hello", "--name", "-x", "world"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "hello --name -x world\n"; out.String() != expected {
+		t.Errorf("expected %q, actual is %q", expected, out.String())
+	}
+	out.Reset()
+	err := app.Execute(context.Background(), []string{"--xbeeDebug", "hello", "again"})
+	if err == nil || err.ExitCode() != 3 {
+		t.Errorf("expected exit code 3 of the plugin, actual error is %v", err)
+	}
+	if expected := "hello --xbeeDebug again\n"; out.String() != expected {
+		t.Errorf("expected %q, actual is %q", expected, out.String())
+	}
+}
+
+func Test_PluginCancelled(t *testing.T) {
+	bin := t.TempDir()
+	writePlugin(t, bin, "xbee-stubborn", "#!/bin/sh\ntrap '' INT\nexec sleep 30\n")
+	p := &Plugin{Path: filepath.Join(bin, "xbee-stubborn"), PluginMetadata: PluginMetadata{Name: "stubborn"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := p.run(ctx, nil); err == nil {
+		t.Errorf("expected an error for a cancelled plugin")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancelled plugin stopped after %v", elapsed)
+	}
+}
+
+func writePlugin(t *testing.T, folder string, name string, script string) {
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(folder, name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
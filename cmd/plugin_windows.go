@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func isExecutable(path string, _ os.FileInfo) bool {
+	return strings.EqualFold(filepath.Ext(path), ".exe")
+}
+
+// terminate kills process : windows has no signal asking a process to stop.
+func terminate(process *os.Process) error {
+	return process.Kill()
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var cleanups struct {
+	sync.Mutex
+	handlers map[int]func()
+	next     int
+}
+
+// OnExit registers f, for instance closing logs, releasing a lock or deleting a temp file, to run by
+// RunCleanups. Handlers run in reverse order of registration. remove unregisters f once it became useless.
+func OnExit(f func()) (remove func()) {
+	cleanups.Lock()
+	defer cleanups.Unlock()
+	if cleanups.handlers == nil {
+		cleanups.handlers = make(map[int]func())
+	}
+	id := cleanups.next
+	cleanups.next++
+	cleanups.handlers[id] = f
+	return func() {
+		cleanups.Lock()
+		defer cleanups.Unlock()
+		delete(cleanups.handlers, id)
+	}
+}
+
+// RunCleanups runs and unregisters handlers registered with OnExit, last registered first.
+func RunCleanups() {
+	cleanups.Lock()
+	handlers := cleanups.handlers
+	last := cleanups.next
+	cleanups.handlers = nil
+	cleanups.Unlock()
+	for id := last - 1; id >= 0; id-- {
+		if f, ok := handlers[id]; ok {
+			f()
+		}
+	}
+}
+
+// Exit runs cleanup handlers, then exits the process with code.
+func Exit(code int) {
+	RunCleanups()
+	osExit(code)
+}
+
+// osExit is os.Exit, replaced by tests.
+var osExit = os.Exit
+
+// exitCodeOf returns the conventional exit code of a process ended by sig : 130 for SIGINT, 143 for SIGTERM.
+func exitCodeOf(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// WithSignals returns a context cancelled on the first SIGINT or SIGTERM, letting the command stop gracefully.
+// A second signal runs cleanup handlers and exits the process at once. stop ends signal handling, and returns an error carrying the
+// exit code of the signal if one was received, nil otherwise.
+func WithSignals(ctx context.Context) (context.Context, func() *XbeeError) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	var received os.Signal
+	var mu sync.Mutex
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				mu.Lock()
+				first := received == nil
+				if first {
+					received = sig
+				}
+				mu.Unlock()
+				if !first {
+					fmt.Fprintf(os.Stderr, "\n%s received again, exiting now\n", sig)
+					Exit(exitCodeOf(sig))
+					return
+				}
+				fmt.Fprintf(os.Stderr, "\n%s received, stopping... send it again to exit now\n", sig)
+				cancel(fmt.Errorf("interrupted by signal %s", sig))
+			}
+		}
+	}()
+	return ctx, func() *XbeeError {
+		signal.Stop(ch)
+		close(done)
+		cancel(nil)
+		mu.Lock()
+		defer mu.Unlock()
+		if received == nil {
+			return nil
+		}
+		return Interrupted(received)
+	}
+}
+
+// Interrupted returns the error of a command stopped by sig, its code being the conventional exit code.
+func Interrupted(sig os.Signal) *XbeeError {
+	err := Error("interrupted by signal %s", sig)
+	err.code = exitCodeOf(sig)
+	return err
+}
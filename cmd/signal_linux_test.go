@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_WithSignals(t *testing.T) {
+	ctx, stop := WithSignals(context.Background())
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled by SIGTERM")
+	}
+	err := stop()
+	if err == nil || err.Code() != 143 {
+		t.Errorf("expected interruption error with code 143, actual is %v", err)
+	}
+	if _, stop := WithSignals(context.Background()); stop() != nil {
+		t.Errorf("expected no error without signal")
+	}
+}
+
+func Test_WithSignalsTwice(t *testing.T) {
+	exited := make(chan int, 1)
+	restore := osExit
+	defer func() { osExit = restore }()
+	osExit = func(code int) { exited <- code }
+	cleaned := false
+	OnExit(func() { cleaned = true })
+	_, stop := WithSignals(context.Background())
+	defer stop()
+	for i := 0; i < 2; i++ {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	select {
+	case code := <-exited:
+		if code != 130 || !cleaned {
+			t.Errorf("expected exit code 130 after cleanups, actual is %d, cleanups run: %v", code, cleaned)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("process not exited on second SIGINT")
+	}
+}
+
+func Test_RunCleanups(t *testing.T) {
+	var calls []int
+	OnExit(func() { calls = append(calls, 1) })
+	remove := OnExit(func() { calls = append(calls, 2) })
+	OnExit(func() { calls = append(calls, 3) })
+	remove()
+	RunCleanups()
+	RunCleanups()
+	if expected := []int{3, 1}; !slices.Equal(calls, expected) {
+		t.Errorf("expected %v, actual is %v", expected, calls)
+	}
+}
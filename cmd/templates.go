@@ -9,10 +9,13 @@ Available commands:
 `
 
 const usageTpl = `
-Usage: xbee {{ .Path }} [OPTIONS] [ARG...]
+Usage: {{ .ProgramName }} {{ .Path }} [OPTIONS] [ARG...]
 
 {{ .Long }}
-
+{{ if .Example }}
+Examples:
+{{ .Example }}
+{{ end }}
 Aliases: {{ if .Aliases }}{{ range .Aliases }} {{ . }} {{ end }}{{ else }}None{{ end }}
 
 ProcessOptions: {{ if .HasOptions }}{{ .OptionsToDisplay }}{{ else }}None{{ end }}
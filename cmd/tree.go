@@ -1,15 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"os"
 	"strings"
 )
 
 // root MUST be initialized through Setup func
 var root Command
-var leaf *Command
-var realArgs []string
-var isHelp bool
 
 // Args without xbee flags
 var Args []string
@@ -43,18 +41,21 @@ func filterValuesOption(args []string) ([]string, []string) {
 	}
 }
 
+// Setup builds the tree of the default App with f, and parses Args.
 func Setup(f func(*Command) *XbeeError) (bool, *XbeeError) {
 	if err := f(&root); err != nil {
 		return false, err
 	}
-	args := Args
-	if len(args) > 0 && args[0] == "help" {
-		isHelp = true
-		args = args[1:]
+	defaultApp.err = addBuiltinCommands(&root)
+	e, err := defaultApp.parse(Args)
+	if e != nil {
+		e.xbeeFlags = XbeeFlags
+		current = e
 	}
-	var err *XbeeError
-	leaf, realArgs, err = findRunnable(&root, args)
-	return leaf != nil, err
+	if err != nil {
+		return false, err
+	}
+	return e.leaf != nil, nil
 }
 
 func RootCommand() *Command {
@@ -66,46 +67,33 @@ func AddCommands(cmds ...*Command) {
 }
 func IsHelp() bool {
 	isH := GlobalOption("help").BooleanValue()
-	return isH || isHelp
+	return isH || (current != nil && current.isHelp)
 }
 
+// Run runs the command parsed by Setup. Its context is cancelled on SIGINT or SIGTERM, see WithSignals ; the
+// error returned then carries the exit code of the signal. A Run command, without context, finds it with Context.
 func Run() *XbeeError {
-	if leaf.ValidateArgs != nil {
-		if err := leaf.ValidateArgs(realArgs); err != nil {
-			return err
+	ctx, stop := WithSignals(context.Background())
+	err := current.run(ctx)
+	if interrupted := stop(); interrupted != nil {
+		if err != nil {
+			interrupted.follows = []*XbeeError{err}
 		}
+		return interrupted
 	}
-	return leaf.Run(realArgs)
+	return err
 }
 
-func Leaf() *Command     { return leaf }
-func RealArgs() []string { return realArgs }
-
-func findRunnable(c *Command, args []string) (*Command, []string, *XbeeError) {
-	if c.Run != nil {
-		realArgs := NewArgsParser(c.Options).ParseArgs(args...)
-		return c, realArgs, nil
+func Leaf() *Command {
+	if current == nil {
+		return nil
 	}
-	if len(args) == 0 {
-		return nil, nil, Error("Command %s needs a subcommand among %v\n", c.Use, c.subCommandNames())
-	}
-	name := args[0]
-	var childFound *Command
-	for _, childC := range c.commands {
-		if childC.Use == name {
-			childFound = childC
-			break
-		}
-		for _, alias := range childC.Aliases {
-			if alias == name {
-				childFound = childC
-				break
-			}
-		}
-	}
-	if childFound == nil {
-		return nil, []string{name}, nil // no command found
-	} else {
-		return findRunnable(childFound, args[1:])
+	return current.leaf
+}
+
+func RealArgs() []string {
+	if current == nil {
+		return nil
 	}
+	return current.realArgs
 }
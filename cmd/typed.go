@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewIntOption creates an option whose values are integers, see IntValue.
+func NewIntOption(name string, shorthand string, defaultValue int) *Option {
+	op := NewOption(name, shorthand, strconv.Itoa(defaultValue))
+	op.typeName = "int"
+	op.validate = func(value string) *XbeeError {
+		if _, err := strconv.Atoi(value); err != nil {
+			return UsageError("option --%s expects an integer, actual is %s", name, value)
+		}
+		return nil
+	}
+	return op
+}
+
+// NewDurationOption creates an option whose values are durations like 90s or 1h30m, see DurationValue.
+func NewDurationOption(name string, shorthand string, defaultValue time.Duration) *Option {
+	op := NewOption(name, shorthand, defaultValue.String())
+	op.typeName = "duration"
+	op.validate = func(value string) *XbeeError {
+		if _, err := time.ParseDuration(value); err != nil {
+			return UsageError("option --%s expects a duration like 90s or 1h30m, actual is %s", name, value)
+		}
+		return nil
+	}
+	return op
+}
+
+// NewEnumOption creates an option whose values must be one of allowed. Allowed values are shown in usage.
+func NewEnumOption(name string, shorthand string, defaultValue string, allowed ...string) *Option {
+	op := NewOption(name, shorthand, defaultValue)
+	op.typeName = "enum"
+	op.allowed = allowed
+	op.validate = func(value string) *XbeeError {
+		if !slices.Contains(allowed, value) {
+			return UsageError("option --%s expects one of %s, actual is %s", name, strings.Join(allowed, ", "), value)
+		}
+		return nil
+	}
+	return op
+}
+
+// NewListOption creates an option given several times, or once with comma separated values.
+func NewListOption(name string, shorthand string) *Option {
+	op := NewOption(name, shorthand, "")
+	op.typeName = "list"
+	op.commaSeparated = true
+	return op
+}
+
+// NewMapOption creates an option whose values are key=value pairs, given several times or comma separated,
+// see MapValue.
+func NewMapOption(name string, shorthand string) *Option {
+	op := NewOption(name, shorthand, "")
+	op.typeName = "key=value"
+	op.commaSeparated = true
+	op.validate = func(value string) *XbeeError {
+		if key, _, ok := strings.Cut(value, "="); !ok || key == "" {
+			return UsageError("option --%s expects key=value, actual is %s", name, value)
+		}
+		return nil
+	}
+	return op
+}
+
+// NewFileOption creates an option whose value is a file path. If mustExist is true, the file must exist.
+func NewFileOption(name string, shorthand string, defaultValue string, mustExist bool) *Option {
+	op := NewOption(name, shorthand, defaultValue)
+	op.typeName = "file"
+	op.validate = func(value string) *XbeeError {
+		if !mustExist {
+			return nil
+		}
+		info, err := os.Stat(value)
+		if err != nil {
+			return UsageError("option --%s expects an existing file, %s does not exist", name, value)
+		}
+		if info.IsDir() {
+			return UsageError("option --%s expects a file, %s is a folder", name, value)
+		}
+		return nil
+	}
+	return op
+}
+
+// parseValue validates and adds a value given on the command line.
+func (op *Option) parseValue(value string) *XbeeError {
+	values := []string{value}
+	if op.commaSeparated {
+		values = strings.Split(value, ",")
+	}
+	for _, v := range values {
+		if op.validate != nil {
+			if err := op.validate(v); err != nil {
+				return err
+			}
+		}
+	}
+	for _, v := range values {
+		op.AddValue(v)
+	}
+	return nil
+}
+
+func (op *Option) IntValue() int {
+	i, _ := strconv.Atoi(op.StringValue())
+	return i
+}
+
+func (op *Option) DurationValue() time.Duration {
+	d, _ := time.ParseDuration(op.StringValue())
+	return d
+}
+
+// MapValue returns values of a map option, the last value of a key winning.
+func (op *Option) MapValue() map[string]string {
+	result := map[string]string{}
+	for _, elt := range op.StringValues() {
+		key, value, _ := strings.Cut(elt, "=")
+		result[key] = value
+	}
+	return result
+}
+
+// Allowed returns values allowed by an enum option, nil otherwise.
+func (op *Option) Allowed() []string {
+	return op.allowed
+}
@@ -9,6 +9,9 @@ func Run(ctx context.Context, name string, args ...string) *cmd.XbeeError {
 	c := NewCommand(name, args...)
 	return c.Run(ctx)
 }
+
+// RunReturnStdOut runs the command and returns its stdout. In dry run, the command is only planned and stdout is
+// empty : queries without side effect should run NewCommand(name, args...).ReadOnly().WithResult() instead.
 func RunReturnStdOut(ctx context.Context, name string, args ...string) (string, *cmd.XbeeError) {
 	c := NewCommand(name, args...).WithResult()
 	err := c.Run(ctx)
@@ -0,0 +1,210 @@
+package exec2
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/stringutils"
+	"gopkg.in/yaml.v3"
+)
+
+// Interaction is a command invocation and its outcome, as saved in a cassette.
+type Interaction struct {
+	Command   string   `yaml:"command"`
+	Args      []string `yaml:"args,omitempty"`
+	Directory string   `yaml:"directory,omitempty"`
+	User      string   `yaml:"user,omitempty"`
+	Env       []string `yaml:"env,omitempty"`
+	Stdout    string   `yaml:"stdout,omitempty"`
+	Stderr    string   `yaml:"stderr,omitempty"`
+	ExitCode  int      `yaml:"exitCode,omitempty"`
+}
+
+type cassette struct {
+	Interactions []*Interaction `yaml:"interactions"`
+}
+
+func invocationOf(c *Command) *Interaction {
+	return &Interaction{
+		Command:   c.name,
+		Args:      c.args,
+		Directory: c.directory,
+		User:      c.user,
+		Env:       c.env,
+	}
+}
+
+func (i *Interaction) sameInvocation(other *Interaction) bool {
+	return i.Command == other.Command &&
+		slices.Equal(i.Args, other.Args) &&
+		i.Directory == other.Directory &&
+		i.User == other.User &&
+		slices.Equal(i.Env, other.Env)
+}
+
+// invocation returns the invocation part of i in yaml, to be compared.
+func (i *Interaction) invocation() string {
+	out, _ := yaml.Marshal(&Interaction{
+		Command:   i.Command,
+		Args:      i.Args,
+		Directory: i.Directory,
+		User:      i.User,
+		Env:       i.Env,
+	})
+	return string(out)
+}
+
+// Recorder is a Runner starting processes and saving each invocation with its stdout, stderr and exit code.
+// Stdout is always captured while recording. Save writes the cassette.
+type Recorder struct {
+	path string
+
+	lock         sync.Mutex
+	interactions []*Interaction
+}
+
+func NewRecorder(path string) *Recorder {
+	return &Recorder{path: path}
+}
+
+// Run executes c, or a copy of c capturing stdout if c does not, so that recording does not change c.
+func (r *Recorder) Run(ctx context.Context, c *Command) (*Result, *cmd.XbeeError) {
+	recorded := c
+	if !c.result {
+		capturing := *c
+		capturing.result = true
+		recorded = &capturing
+	}
+	result, err := processRunner{}.Run(ctx, recorded)
+	interaction := invocationOf(c)
+	interaction.Stdout, interaction.Stderr, interaction.ExitCode = result.Stdout, result.Stderr, result.ExitCode
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.interactions = append(r.interactions, interaction)
+	return result, err
+}
+
+// Save writes recorded interactions to the cassette file, creating its directory if needed.
+func (r *Recorder) Save() *cmd.XbeeError {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	out, err := yaml.Marshal(&cassette{Interactions: r.interactions})
+	if err != nil {
+		return cmd.Error("cannot marshal cassette %s : %v", r.path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return cmd.Error("cannot create directory for cassette %s : %v", r.path, err)
+	}
+	if err := os.WriteFile(r.path, out, 0644); err != nil {
+		return cmd.Error("cannot write cassette %s : %v", r.path, err)
+	}
+	return nil
+}
+
+// Replayer is a Runner serving interactions of a cassette back, without starting any process.
+// A command matches the first unused interaction with the same command, args, directory, user and env.
+type Replayer struct {
+	path string
+
+	lock         sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+func NewReplayer(path string) (*Replayer, *cmd.XbeeError) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, cmd.Error("cannot read cassette %s : %v", path, err)
+	}
+	var c cassette
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, cmd.Error("cannot unmarshal cassette %s : %v", path, err)
+	}
+	return &Replayer{
+		path:         path,
+		interactions: c.Interactions,
+		used:         make([]bool, len(c.Interactions)),
+	}, nil
+}
+
+// Run replays the matching interaction. If none matches, the error shows the diff with the next unused one.
+func (r *Replayer) Run(_ context.Context, c *Command) (*Result, *cmd.XbeeError) {
+	interaction, err := r.match(invocationOf(c))
+	if err != nil {
+		return &Result{CommandLine: c.String(), ExitCode: -1}, err
+	}
+	return c.replay(interaction)
+}
+
+func (r *Replayer) match(actual *Interaction) (*Interaction, *cmd.XbeeError) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	next := -1
+	for index, interaction := range r.interactions {
+		if r.used[index] {
+			continue
+		}
+		if interaction.sameInvocation(actual) {
+			r.used[index] = true
+			return interaction, nil
+		}
+		if next == -1 {
+			next = index
+		}
+	}
+	if next == -1 {
+		return nil, cmd.Error("command [%s] not expected, all interactions of cassette %s are used :\n%s",
+			commandLine(actual), r.path, actual.invocation())
+	}
+	return nil, cmd.Error("command [%s] does not match cassette %s, diff with next interaction :\n%s",
+		commandLine(actual), r.path, stringutils.Diff(r.interactions[next].invocation(), actual.invocation()))
+}
+
+// Unused returns interactions of the cassette which were not replayed.
+func (r *Replayer) Unused() (result []*Interaction) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for index, interaction := range r.interactions {
+		if !r.used[index] {
+			result = append(result, interaction)
+		}
+	}
+	return
+}
+
+func commandLine(i *Interaction) string {
+	return NewCommand(i.Command, i.Args...).String()
+}
+
+// replay shows and captures the output of interaction as if the command had run.
+func (c *Command) replay(interaction *Interaction) (*Result, *cmd.XbeeError) {
+	outTarget, errTarget := c.outputTargets()
+	c.bErr = newMachineReadableWriter(errTarget).WithLimit(StderrLimit)
+	out := outTarget
+	if c.result {
+		c.bOut = newMachineReadableWriter(outTarget)
+		out = c.bOut
+	}
+	if out != nil {
+		_, _ = io.WriteString(out, interaction.Stdout)
+	}
+	_, _ = io.WriteString(c.bErr, interaction.Stderr)
+	for _, lw := range c.lineWriters {
+		_ = lw.Flush()
+	}
+	result := &Result{
+		CommandLine: c.String(),
+		ExitCode:    interaction.ExitCode,
+		Stdout:      c.Result(),
+		Stderr:      c.bErr.String(),
+	}
+	if interaction.ExitCode != 0 {
+		return result, cmd.Error("this command (%s) failed : exit status %d%s", c.String(), interaction.ExitCode, lastLines(result.Stderr, stderrLinesInError))
+	}
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package exec2
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func Test_RecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.yaml")
+	recorder := NewRecorder(path)
+	restore := SetRunner(recorder)
+	out, err := RunReturnStdOut(context.Background(), "echo", "hello")
+	restore()
+	if err != nil || out != "hello\n" {
+		t.Fatalf("unexpected result %q, %v", out, err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer SetRunner(replayer)()
+	out, err = RunReturnStdOut(context.Background(), "echo", "hello")
+	if err != nil || out != "hello\n" {
+		t.Errorf("unexpected replayed result %q, %v", out, err)
+	}
+	if _, err := RunReturnStdOut(context.Background(), "echo", "hello"); err == nil {
+		t.Errorf("expected an error, cassette has only one interaction")
+	}
+}
+
+func Test_RecordKeepsCommand(t *testing.T) {
+	recorder := NewRecorder(filepath.Join(t.TempDir(), "cassette.yaml"))
+	defer SetRunner(recorder)()
+	c := NewCommand("echo", "hello").Quiet()
+	result, err := c.Execute(context.Background())
+	if err != nil || result.Stdout != "hello\n" {
+		t.Fatalf("unexpected result %v, %v", result, err)
+	}
+	if c.result || c.bOut != nil {
+		t.Errorf("recording changed the command")
+	}
+	if recorder.interactions[0].Stdout != "hello\n" {
+		t.Errorf("expected stdout recorded, actual is %q", recorder.interactions[0].Stdout)
+	}
+}
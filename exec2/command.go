@@ -2,13 +2,38 @@ package exec2
 
 import (
 	"context"
+	"errors"
 	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/log2"
+	"io"
 	"os"
 	"os/exec"
-	"os/user"
 	"strings"
+	"time"
 )
 
+// DefaultWaitDelay is the time left to a cancelled command to exit after SIGTERM, before SIGKILL is sent.
+const DefaultWaitDelay = 5 * time.Second
+
+// StderrLimit is the number of bytes of stderr kept in a Result, the tail being kept.
+const StderrLimit = 64 * 1024
+
+// stderrLinesInError is the number of last lines of stderr added to the message of a failed command.
+const stderrLinesInError = 10
+
+var errTimeout = errors.New("timeout")
+
+// Result is the outcome of a command. ExitCode is -1 if the command could not start or was killed by a signal.
+// Stdout is only captured with WithResult.
+type Result struct {
+	CommandLine string
+	ExitCode    int
+	Signal      string
+	Duration    time.Duration
+	Stdout      string
+	Stderr      string
+}
+
 type Command struct {
 	name string
 	args []string
@@ -19,14 +44,26 @@ type Command struct {
 	result bool
 
 	user      string
+	login     bool
 	directory string
 	env       []string
+
+	timeout   time.Duration
+	waitDelay time.Duration
+	retry     *RetryPolicy
+	readOnly  bool
+
+	prefix      string
+	callback    func(line string)
+	logf        func(format string, a ...interface{})
+	lineWriters []*LineWriter
 }
 
 func NewCommand(name string, args ...string) *Command {
 	c := &Command{
-		name: name,
-		args: args,
+		name:      name,
+		args:      args,
+		waitDelay: DefaultWaitDelay,
 	}
 	return c
 }
@@ -47,76 +84,234 @@ func (c *Command) WithDirectory(dir string) *Command {
 	c.directory = dir
 	return c
 }
+
+// WithUser runs the command as user, with HOME, USER and LOGNAME of user. Nothing is done if user is the current user.
 func (c *Command) WithUser(user string) *Command {
 	c.user = user
 	return c
 }
+
+// WithLogin gives a login environment to the command run WithUser : the environment is reset, and the command
+// runs in the home directory of the user, unless WithDirectory is used.
+func (c *Command) WithLogin() *Command {
+	c.login = true
+	return c
+}
+
+// WithEnv adds variables in the form KEY=VALUE to the environment of the command.
 func (c *Command) WithEnv(env []string) *Command {
-	c.env = os.Environ()
 	c.env = append(c.env, env...)
 	return c
 }
 
-func (c *Command) Quiet() *Command {
-	c.quiet = true
+// WithTimeout cancels the command if it does not end before d.
+func (c *Command) WithTimeout(d time.Duration) *Command {
+	c.timeout = d
 	return c
 }
 
-func (c *Command) createCmd(ctx context.Context) *exec.Cmd {
-	var aCmd *exec.Cmd
-	name := c.name
-	args := c.args
+// WithRetry runs the command again on failure, as defined by policy. The Result of the last attempt is returned.
+func (c *Command) WithRetry(policy *RetryPolicy) *Command {
+	c.retry = policy
+	return c
+}
 
-	if c.user != "" {
-		currentUser, err := user.Current()
-		if err != nil { // this should not occur
-			panic(cmd.Error("cannot get current user : %v", err))
-		}
-		if c.user != currentUser.Name {
-			name = "su"
-			args = append(args, "-l", "-c", c.String(), c.user)
-		}
+// WithWaitDelay sets the grace period between SIGTERM and SIGKILL when the command is cancelled. A non positive
+// d is ignored, since the command could then never be killed.
+func (c *Command) WithWaitDelay(d time.Duration) *Command {
+	if d > 0 {
+		c.waitDelay = d
 	}
+	return c
+}
 
-	if ctx != nil {
-		aCmd = exec.CommandContext(ctx, name, args...)
-	} else {
-		aCmd = exec.Command(c.name, args...)
+// WithPrefix shows output line by line, each line being timestamped and prefixed with [label].
+func (c *Command) WithPrefix(label string) *Command {
+	c.prefix = label
+	return c
+}
+
+// WithLineCallback gives each line of stdout and stderr to f, even if the command is quiet. See PercentCallback.
+func (c *Command) WithLineCallback(f func(line string)) *Command {
+	c.callback = f
+	return c
+}
+
+// WithLogLevel sends each line of stdout and stderr to log2 at level, one of debug, info, warn or error, even if
+// the command is quiet. An unknown level is reported as a warning, and lines are logged at info level.
+func (c *Command) WithLogLevel(level string) *Command {
+	logf, err := log2.Logf(level)
+	if err != nil {
+		log2.Warnf("%s : %v", c, err)
+		logf = log2.Infof
 	}
+	c.logf = logf
+	return c
+}
 
-	if c.quiet {
-		c.bErr = NewMachineOnlyReadableWriter()
-		if c.result {
-			c.bOut = NewMachineOnlyReadableWriter()
-			aCmd.Stdout = c.bOut
-		}
-	} else {
-		c.bErr = NewStdErrMachineReadableWriter()
-		if c.result {
-			c.bOut = NewStdOutMachineReadableWriter()
-			aCmd.Stdout = c.bOut
-		} else {
-			aCmd.Stdout = os.Stdout
-		}
+// ReadOnly marks a command without side effect, which runs even in dry run.
+func (c *Command) ReadOnly() *Command {
+	c.readOnly = true
+	return c
+}
+
+func (c *Command) Quiet() *Command {
+	c.quiet = true
+	return c
+}
+
+func (c *Command) createCmd(ctx context.Context) (*exec.Cmd, *cmd.XbeeError) {
+	aCmd := exec.CommandContext(ctx, c.name, c.args...)
+
+	outTarget, errTarget := c.outputTargets()
+	c.bErr = newMachineReadableWriter(errTarget).WithLimit(StderrLimit)
+	if c.result {
+		c.bOut = newMachineReadableWriter(outTarget)
+		aCmd.Stdout = c.bOut
+	} else if outTarget != nil {
+		aCmd.Stdout = outTarget
+	}
+	if !c.quiet {
 		aCmd.Stdin = os.Stdin
 	}
 	aCmd.Stderr = c.bErr
 
 	aCmd.Dir = c.directory
 	if c.env != nil {
-		aCmd.Env = c.env
+		aCmd.Env = append(os.Environ(), c.env...)
 	}
-
-	return aCmd
+	if err := c.switchUser(aCmd); err != nil {
+		return nil, err
+	}
+	return aCmd, nil
 }
 
+// Run executes the command, see Execute.
 func (c *Command) Run(ctx context.Context) *cmd.XbeeError {
-	aCmd := c.createCmd(ctx)
-	err := aCmd.Run()
+	_, err := c.Execute(ctx)
+	return err
+}
+
+// Execute runs the command and returns its Result, which is never nil. If ctx is cancelled or the timeout expires,
+// the whole process group of the command receives SIGTERM, then SIGKILL after the wait delay.
+// In dry run, the command is only planned, unless it is ReadOnly.
+// The message of the returned error ends with the last lines of stderr.
+func (c *Command) Execute(ctx context.Context) (*Result, *cmd.XbeeError) {
+	if cmd.IsDryRun(ctx) && !c.readOnly {
+		cmd.Plan(ctx, "run %s", c)
+		return &Result{CommandLine: c.String()}, nil
+	}
+	if c.retry == nil {
+		return c.execute(ctx)
+	}
+	var result *Result
+	err := c.retry.Do(ctx, c.String(), func(ctx context.Context) (int, string, *cmd.XbeeError) {
+		var err *cmd.XbeeError
+		result, err = c.execute(ctx)
+		if result == nil {
+			return -1, "", err
+		}
+		return result.ExitCode, result.Stderr, err
+	})
+	return result, err
+}
+
+// execute runs one attempt of the command with the current Runner.
+func (c *Command) execute(ctx context.Context) (*Result, *cmd.XbeeError) {
+	return currentRunner().Run(ctx, c)
+}
+
+// startAndWait runs the command in a new process.
+func (c *Command) startAndWait(ctx context.Context) (*Result, *cmd.XbeeError) {
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	aCmd, err := c.createCmd(ctx)
+	if err != nil {
+		return &Result{CommandLine: c.String(), ExitCode: -1}, err
+	}
+	release := c.killGroupOnCancel(aCmd)
+	start := time.Now()
+	err2 := aCmd.Run()
+	release()
+	return c.outcome(ctx, aCmd, start, err2)
+}
+
+// context applies the timeout of the command to ctx.
+func (c *Command) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = cmd.Context()
+	}
+	if c.timeout > 0 {
+		return context.WithTimeoutCause(ctx, c.timeout, errTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// outcome builds the Result and the error of an ended command, err being returned by its Run or Wait.
+func (c *Command) outcome(ctx context.Context, aCmd *exec.Cmd, start time.Time, err error) (*Result, *cmd.XbeeError) {
+	for _, lw := range c.lineWriters {
+		_ = lw.Flush()
+	}
+	result := &Result{
+		CommandLine: aCmd.String(),
+		ExitCode:    -1,
+		Duration:    time.Since(start),
+		Stdout:      c.Result(),
+		Stderr:      c.bErr.String(),
+	}
+	if aCmd.ProcessState != nil {
+		result.ExitCode = aCmd.ProcessState.ExitCode()
+		result.Signal = signalOf(aCmd.ProcessState)
+	}
 	if err != nil {
-		return cmd.Error("this command (%s) failed : %v", c.String(), err)
+		tail := lastLines(result.Stderr, stderrLinesInError)
+		if errors.Is(context.Cause(ctx), errTimeout) {
+			return result, cmd.TimeoutError("this command (%s) killed by timeout after %s%s", c.String(), c.timeout, tail).WithCommand(c.String())
+		}
+		if ctx.Err() != nil {
+			return result, cmd.Error("this command (%s) cancelled : %v%s", c.String(), ctx.Err(), tail).WithCommand(c.String())
+		}
+		return result, cmd.Error("this command (%s) failed : %v%s", c.String(), err, tail).WithCommand(c.String())
+	}
+	return result, nil
+}
+
+// outputTargets returns where stdout and stderr are shown, nil meaning they are not.
+func (c *Command) outputTargets() (io.Writer, io.Writer) {
+	if c.prefix == "" && c.callback == nil && c.logf == nil {
+		if c.quiet {
+			return nil, nil
+		}
+		return os.Stdout, os.Stderr
+	}
+	out, errW := NewLineWriter().WithPrefix(c.prefix), NewLineWriter().WithPrefix(c.prefix)
+	if c.callback != nil {
+		out.WithCallback(c.callback)
+		errW.WithCallback(c.callback)
+	}
+	if c.logf != nil {
+		out.ToLog(c.logf)
+		errW.ToLog(c.logf)
+	}
+	if !c.quiet {
+		out.WithTimestamp().To(os.Stdout)
+		errW.WithTimestamp().To(os.Stderr)
+	}
+	c.lineWriters = []*LineWriter{out, errW}
+	return out, errW
+}
+
+// lastLines returns the last n lines of s, preceded by a new line, or an empty string.
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	result := strings.Join(lines, "\n")
+	if strings.TrimSpace(result) == "" {
+		return ""
 	}
-	return nil
+	return "\n" + result
 }
 
 func (c *Command) Result() string {
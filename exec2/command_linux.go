@@ -0,0 +1,66 @@
+package exec2
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// process identifies a process by its pid and start time, so that a reused pid is never signalled.
+type process struct {
+	pid       int
+	startTime string
+}
+
+func (p process) signal(sig syscall.Signal) error {
+	if _, startTime, ok := readStat(p.pid); !ok || startTime != p.startTime {
+		return syscall.ESRCH
+	}
+	return syscall.Kill(p.pid, sig)
+}
+
+// processTree returns pid and its descendants, read from /proc.
+func processTree(pid int) []process {
+	children := map[int][]int{}
+	entries, _ := os.ReadDir("/proc")
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if ppid, _, ok := readStat(child); ok {
+			children[ppid] = append(children[ppid], child)
+		}
+	}
+	var result []process
+	pending := []int{pid}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = append(pending[1:], children[current]...)
+		if _, startTime, ok := readStat(current); ok {
+			result = append(result, process{pid: current, startTime: startTime})
+		}
+	}
+	return result
+}
+
+// readStat returns the parent pid and the start time of pid, from /proc/<pid>/stat.
+func readStat(pid int) (ppid int, startTime string, ok bool) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, "", false
+	}
+	// the command name, in parentheses, may contain spaces
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return 0, "", false
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	// fields start at state (3rd field of stat) : ppid is the 4th, start time the 22nd
+	if len(fields) < 20 {
+		return 0, "", false
+	}
+	ppid, err = strconv.Atoi(fields[1])
+	return ppid, fields[19], err == nil
+}
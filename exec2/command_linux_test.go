@@ -0,0 +1,113 @@
+package exec2
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// grandChild runs a shell starting a sleep ignoring SIGTERM, and returns its pid, once started.
+func grandChild(t *testing.T, c *Command, pidFile string) (int, chan bool) {
+	done := make(chan bool)
+	go func() {
+		_ = c.Run(context.Background())
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(pidFile); err == nil && strings.HasSuffix(string(data), "\n") {
+			pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+			return pid, done
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("grand child not started")
+	return 0, nil
+}
+
+func alive(pid int) bool {
+	_, _, ok := readStat(pid)
+	if !ok {
+		return false
+	}
+	data, _ := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	return !strings.Contains(string(data), ") Z ")
+}
+
+func Test_TimeoutKillsGrandChildren(t *testing.T) {
+	for _, terminal := range []bool{false, true} {
+		t.Run("terminal="+strconv.FormatBool(terminal), func(t *testing.T) {
+			restore := readsTerminal
+			defer func() { readsTerminal = restore }()
+			readsTerminal = func(*exec.Cmd) bool { return terminal }
+			timeoutKillsGrandChildren(t)
+		})
+	}
+}
+
+func timeoutKillsGrandChildren(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	c := NewCommand("sh", "-c", `(trap '' TERM; exec sleep 30) & echo $! > `+pidFile+`; wait`).
+		WithTimeout(300 * time.Millisecond).WithWaitDelay(200 * time.Millisecond).Quiet()
+	pid, done := grandChild(t, c, pidFile)
+	<-done
+	deadline := time.Now().Add(2 * time.Second)
+	for alive(pid) && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if alive(pid) {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("grand child %d still alive after timeout", pid)
+	}
+}
+
+func Test_ProcessTree(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	c := NewCommand("sh", "-c", `sleep 30 & echo $! > `+pidFile+`; wait`).Quiet()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	aCmd, err := c.createCmd(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var sleep int
+	for i := 0; i < 500 && sleep == 0; i++ {
+		if data, err := os.ReadFile(pidFile); err == nil && strings.HasSuffix(string(data), "\n") {
+			sleep, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var pids []int
+	for _, p := range processTree(aCmd.Process.Pid) {
+		pids = append(pids, p.pid)
+	}
+	if len(pids) != 2 || pids[0] != aCmd.Process.Pid || pids[1] != sleep {
+		t.Errorf("expected tree [%d %d], actual is %v", aCmd.Process.Pid, sleep, pids)
+	}
+	for _, p := range processTree(aCmd.Process.Pid) {
+		_ = p.signal(syscall.SIGKILL)
+	}
+	_ = aCmd.Wait()
+}
+
+func Test_ResultOfSignaledCommand(t *testing.T) {
+	result, err := NewCommand("sh", "-c", "echo dying >&2; kill -TERM $$").Quiet().Execute(context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if result.ExitCode != -1 || result.Signal != syscall.SIGTERM.String() {
+		t.Errorf("expected exit code -1 and signal %q, actual are %d and %q", syscall.SIGTERM.String(), result.ExitCode, result.Signal)
+	}
+	if message := err.Tree().Message; !strings.Contains(message, "signal: terminated") || !strings.HasSuffix(message, "\ndying") {
+		t.Errorf("expected signal and stderr in message, actual is %q", message)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows && !linux
+
+package exec2
+
+import "syscall"
+
+// process is a process to signal : without /proc, descendants are not known.
+type process struct {
+	pid int
+}
+
+func (p process) signal(sig syscall.Signal) error {
+	return syscall.Kill(p.pid, sig)
+}
+
+// processTree returns pid only : its descendants cannot be listed without /proc.
+func processTree(pid int) []process {
+	return []process{{pid: pid}}
+}
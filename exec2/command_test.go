@@ -0,0 +1,62 @@
+package exec2
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func Test_ResultOfFailedCommand(t *testing.T) {
+	result, err := NewCommand("sh", "-c", "echo out; echo x >&2; exit 3").WithResult().Quiet().Execute(context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if result.ExitCode != 3 || result.Signal != "" {
+		t.Errorf("expected exit code 3 without signal, actual are %d and %q", result.ExitCode, result.Signal)
+	}
+	if result.Duration <= 0 {
+		t.Errorf("expected a duration, actual is %v", result.Duration)
+	}
+	if result.Stdout != "out\n" || result.Stderr != "x\n" {
+		t.Errorf("unexpected stdout %q or stderr %q", result.Stdout, result.Stderr)
+	}
+	if !strings.Contains(result.CommandLine, "exit 3") {
+		t.Errorf("unexpected command line %q", result.CommandLine)
+	}
+	message := err.Tree().Message
+	if !strings.Contains(message, "failed : exit status 3") || !strings.HasSuffix(message, "\nx") {
+		t.Errorf("expected exit status and stderr in message, actual is %q", message)
+	}
+	if err.Field("command") == "" {
+		t.Errorf("expected the command in the error fields")
+	}
+}
+
+func Test_StderrTailInError(t *testing.T) {
+	_, err := NewCommand("sh", "-c", "for i in 1 2 3 4 5 6 7 8 9 10 11 12; do echo line$i >&2; done; exit 1").Quiet().Execute(context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	message := err.Tree().Message
+	if !strings.HasSuffix(message, "\nline3\nline4\nline5\nline6\nline7\nline8\nline9\nline10\nline11\nline12") {
+		t.Errorf("expected the last 10 lines of stderr, actual is %q", message)
+	}
+	if strings.Contains(message, "line2\n") {
+		t.Errorf("expected only the last 10 lines of stderr, actual is %q", message)
+	}
+}
+
+func Test_StderrLimit(t *testing.T) {
+	// 100 KiB of stderr, then a last line
+	script := "i=0; while [ $i -lt 1600 ]; do printf '%063d\\n' $i >&2; i=$((i+1)); done; echo end >&2"
+	result, err := NewCommand("sh", "-c", script).Quiet().Execute(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Stderr) != StderrLimit {
+		t.Errorf("expected %d bytes of stderr, actual is %d", StderrLimit, len(result.Stderr))
+	}
+	if !strings.HasSuffix(result.Stderr, "\nend\n") {
+		t.Errorf("expected the tail of stderr to be kept, actual ends with %q", result.Stderr[len(result.Stderr)-20:])
+	}
+}
@@ -0,0 +1,96 @@
+//go:build !windows
+
+package exec2
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// killGroupOnCancel starts the command in its own process group, so that cancellation reaches its children too.
+// A command reading the terminal stays in the foreground group, otherwise it would be stopped by SIGTTIN : the
+// command and its descendants, found in /proc on linux, are signalled one by one then.
+// release must be called once Wait returned : processes left by a cancelled command are killed, and the
+// SIGKILL timer is stopped, so that it never hits a reused process group.
+func (c *Command) killGroupOnCancel(aCmd *exec.Cmd) (release func()) {
+	aCmd.WaitDelay = c.waitDelay
+	inTerminal := readsTerminal(aCmd)
+	if !inTerminal {
+		if aCmd.SysProcAttr == nil {
+			aCmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		aCmd.SysProcAttr.Setpgid = true
+	}
+	var mu sync.Mutex
+	var timer *time.Timer
+	var cancelled, released bool
+	var tree []process // processes signalled, when in terminal
+	signal := func(sig syscall.Signal) error {
+		pid := aCmd.Process.Pid
+		if !inTerminal {
+			return syscall.Kill(-pid, sig)
+		}
+		if tree == nil {
+			tree = processTree(pid)
+		}
+		var result error = syscall.ESRCH
+		for _, p := range tree {
+			if err := p.signal(sig); err == nil {
+				result = nil
+			}
+		}
+		return result
+	}
+	aCmd.Cancel = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if released {
+			return os.ErrProcessDone
+		}
+		cancelled = true
+		timer = time.AfterFunc(c.waitDelay, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if !released {
+				_ = signal(syscall.SIGKILL)
+			}
+		})
+		if err := signal(syscall.SIGTERM); errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		} else {
+			return err
+		}
+	}
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if released {
+			return
+		}
+		released = true
+		if timer != nil {
+			timer.Stop()
+		}
+		if cancelled {
+			_ = signal(syscall.SIGKILL)
+		}
+	}
+}
+
+// readsTerminal returns true if the command reads the terminal, replaced by tests.
+var readsTerminal = func(aCmd *exec.Cmd) bool {
+	return aCmd.Stdin == os.Stdin && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+func signalOf(state *os.ProcessState) string {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal().String()
+	}
+	return ""
+}
@@ -0,0 +1,16 @@
+package exec2
+
+import (
+	"os"
+	"os/exec"
+)
+
+// killGroupOnCancel only kills the command itself : windows has no process group signals.
+func (c *Command) killGroupOnCancel(aCmd *exec.Cmd) (release func()) {
+	aCmd.WaitDelay = c.waitDelay
+	return func() {}
+}
+
+func signalOf(_ *os.ProcessState) string {
+	return ""
+}
@@ -0,0 +1,133 @@
+package exec2
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputLock serializes lines written by all LineWriters, so that lines of commands run in parallel do not mix.
+var outputLock sync.Mutex
+
+// A LineWriter splits data into lines, and gives each complete line, eventually prefixed with a label and a
+// timestamp, to its writers, log functions and callbacks. Flush must be called to get the last unterminated line.
+type LineWriter struct {
+	label     string
+	timestamp bool
+	writers   []io.Writer
+	logfs     []func(format string, a ...interface{})
+	callbacks []func(line string)
+
+	lock sync.Mutex
+	buf  []byte
+}
+
+func NewLineWriter() *LineWriter {
+	return &LineWriter{}
+}
+
+// WithPrefix puts [label] in front of each line.
+func (lw *LineWriter) WithPrefix(label string) *LineWriter {
+	lw.label = label
+	return lw
+}
+
+func (lw *LineWriter) WithTimestamp() *LineWriter {
+	lw.timestamp = true
+	return lw
+}
+
+func (lw *LineWriter) To(w io.Writer) *LineWriter {
+	lw.writers = append(lw.writers, w)
+	return lw
+}
+
+// ToLog sends each line to a log2 function, which sets the level, for instance log2.Debugf.
+func (lw *LineWriter) ToLog(logf func(format string, a ...interface{})) *LineWriter {
+	lw.logfs = append(lw.logfs, logf)
+	return lw
+}
+
+// WithCallback gives each raw line, without prefix, to f. See PercentCallback.
+func (lw *LineWriter) WithCallback(f func(line string)) *LineWriter {
+	lw.callbacks = append(lw.callbacks, f)
+	return lw
+}
+
+func (lw *LineWriter) Write(p []byte) (int, error) {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	lw.buf = append(lw.buf, p...)
+	for {
+		index := bytes.IndexByte(lw.buf, '\n')
+		if index == -1 {
+			break
+		}
+		line := string(lw.buf[:index])
+		lw.buf = lw.buf[index+1:]
+		if err := lw.emit(line); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush emits the last line if it is not terminated by a new line.
+func (lw *LineWriter) Flush() error {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	line := string(lw.buf)
+	lw.buf = nil
+	return lw.emit(line)
+}
+
+func (lw *LineWriter) emit(line string) error {
+	line = strings.TrimRight(line, "\r")
+	for _, f := range lw.callbacks {
+		f(line)
+	}
+	prefixed := line
+	if lw.label != "" {
+		prefixed = "[" + lw.label + "] " + prefixed
+	}
+	for _, logf := range lw.logfs {
+		logf("%s", prefixed)
+	}
+	if len(lw.writers) == 0 {
+		return nil
+	}
+	if lw.timestamp {
+		prefixed = time.Now().Format("15:04:05.000") + " " + prefixed
+	}
+	data := []byte(prefixed + "\n")
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	for _, w := range lw.writers {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var percentRegexp = regexp.MustCompile(`(\d{1,3})(?:\.\d+)?\s?%`)
+
+// PercentCallback returns a callback calling f with the last percentage found in a line, like 42 in "copying... 42%".
+func PercentCallback(f func(percent int)) func(line string) {
+	return func(line string) {
+		matches := percentRegexp.FindAllStringSubmatch(line, -1)
+		if len(matches) == 0 {
+			return
+		}
+		if percent, err := strconv.Atoi(matches[len(matches)-1][1]); err == nil && percent <= 100 {
+			f(percent)
+		}
+	}
+}
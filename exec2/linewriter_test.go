@@ -0,0 +1,116 @@
+package exec2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iodasolutions/xbee-common/log2"
+)
+
+func Test_WithLogLevel(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+		_ = w.Close()
+	}()
+	var mu sync.Mutex
+	var logged bytes.Buffer
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			mu.Lock()
+			logged.Write(buf[:n])
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	if _, err := NewCommand("sh", "-c", "echo building; echo 'failed step' >&2").WithPrefix("app").WithLogLevel("warn").Quiet().Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"WARN : [app] building\n", "WARN : [app] failed step\n"}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		actual := logged.String()
+		mu.Unlock()
+		found := true
+		for _, line := range expected {
+			found = found && strings.Contains(actual, line)
+		}
+		if found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected log lines %q, actual output is %q", expected, actual)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_UnknownLogLevel(t *testing.T) {
+	if _, err := log2.Logf("verbose"); err == nil {
+		t.Errorf("expected an error for an unknown level")
+	}
+	if c := NewCommand("true").WithLogLevel("verbose"); c.logf == nil {
+		t.Errorf("expected lines logged at the default level")
+	}
+}
+
+func Test_LineWriterPrefixAndFlush(t *testing.T) {
+	var out bytes.Buffer
+	var lines []string
+	lw := NewLineWriter().WithPrefix("host").To(&out).WithCallback(func(line string) { lines = append(lines, line) })
+	_, _ = lw.Write([]byte("first\r\nsec"))
+	_, _ = lw.Write([]byte("ond\nunterminated"))
+	if expected := "[host] first\n[host] second\n"; out.String() != expected {
+		t.Errorf("expected %q before Flush, actual is %q", expected, out.String())
+	}
+	if err := lw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "[host] first\n[host] second\n[host] unterminated\n"; out.String() != expected {
+		t.Errorf("expected %q after Flush, actual is %q", expected, out.String())
+	}
+	if expected := []string{"first", "second", "unterminated"}; strings.Join(lines, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected raw lines %v, actual are %v", expected, lines)
+	}
+	if err := lw.Flush(); err != nil || strings.Count(out.String(), "\n") != 3 {
+		t.Errorf("expected a second Flush to emit nothing, output is %q", out.String())
+	}
+}
+
+func Test_LineWriterTimestamp(t *testing.T) {
+	var out bytes.Buffer
+	lw := NewLineWriter().WithPrefix("app").WithTimestamp().To(&out)
+	_, _ = lw.Write([]byte("started\n"))
+	if !regexp.MustCompile(`^\d{2}:\d{2}:\d{2}\.\d{3} \[app\] started\n$`).MatchString(out.String()) {
+		t.Errorf("expected a timestamped line, actual is %q", out.String())
+	}
+}
+
+func Test_PercentCallback(t *testing.T) {
+	var percents []int
+	callback := PercentCallback(func(percent int) { percents = append(percents, percent) })
+	for _, line := range []string{"copying... 42%", "no progress", "3.5 % then 17%", "250%", "100 %"} {
+		callback(line)
+	}
+	if expected := "[42 17 100]"; fmt.Sprint(percents) != expected {
+		t.Errorf("expected percents %s, actual are %v", expected, percents)
+	}
+}
@@ -11,6 +11,7 @@ import (
 type MachineReadableWriter struct {
 	buf     *bytes.Buffer
 	writers []io.Writer
+	limit   int
 }
 
 func NewMachineOnlyReadableWriter() *MachineReadableWriter {
@@ -19,6 +20,14 @@ func NewMachineOnlyReadableWriter() *MachineReadableWriter {
 	}
 }
 
+func newMachineReadableWriter(w io.Writer) *MachineReadableWriter {
+	mrw := NewMachineOnlyReadableWriter()
+	if w != nil {
+		mrw.writers = []io.Writer{w}
+	}
+	return mrw
+}
+
 func NewStdOutMachineReadableWriter() *MachineReadableWriter {
 	return &MachineReadableWriter{
 		buf:     &bytes.Buffer{},
@@ -33,12 +42,21 @@ func NewStdErrMachineReadableWriter() *MachineReadableWriter {
 	}
 }
 
+// WithLimit keeps only the last limit bytes in memory.
+func (mrw *MachineReadableWriter) WithLimit(limit int) *MachineReadableWriter {
+	mrw.limit = limit
+	return mrw
+}
+
 func (mrw *MachineReadableWriter) Write(p []byte) (n int, err error) {
 	if mrw.buf != nil {
 		n, err = mrw.buf.Write(p)
 		if err != nil {
 			return
 		}
+		if mrw.limit > 0 && mrw.buf.Len() > mrw.limit {
+			mrw.buf.Next(mrw.buf.Len() - mrw.limit)
+		}
 	}
 	for _, writer := range mrw.writers {
 		n, err = writer.Write(p)
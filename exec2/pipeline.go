@@ -0,0 +1,229 @@
+package exec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+)
+
+// FileCreator is implemented by newfs.File.
+type FileCreator interface {
+	OpenFileForCreation() (*os.File, *cmd.XbeeError)
+}
+
+// Pipe chains commands like a shell pipeline, the stdout of each command being the stdin of the next one.
+type Pipe struct {
+	commands []*Command
+	stdin    io.Reader
+	stdout   io.Writer
+	file     FileCreator
+}
+
+// Pipeline creates a pipeline of cmds, without any shell. Options of each command (timeout, user, directory,
+// environment...) apply to its own stage.
+func Pipeline(cmds ...*Command) *Pipe {
+	return &Pipe{commands: cmds}
+}
+
+// WithStdin gives r as stdin to the first command.
+func (p *Pipe) WithStdin(r io.Reader) *Pipe {
+	p.stdin = r
+	return p
+}
+
+// WithStdout writes the stdout of the last command into w.
+func (p *Pipe) WithStdout(w io.Writer) *Pipe {
+	p.stdout = w
+	return p
+}
+
+// ToFile writes the stdout of the last command into f, for instance a newfs.File.
+func (p *Pipe) ToFile(f FileCreator) *Pipe {
+	p.file = f
+	return p
+}
+
+func (p *Pipe) String() string {
+	var s []string
+	for _, c := range p.commands {
+		s = append(s, c.String())
+	}
+	return strings.Join(s, " | ")
+}
+
+// Run executes the pipeline, see Execute.
+func (p *Pipe) Run(ctx context.Context) *cmd.XbeeError {
+	_, err := p.Execute(ctx)
+	return err
+}
+
+// Execute runs all commands concurrently and waits for all of them. It returns the Result of each stage, a
+// planned empty Result in dry run.
+// Cancelling ctx cancels every stage. The error names the failing stage and its exit code ; a stage killed
+// by SIGPIPE is only reported if no other stage failed, since it is usually a consequence of another failure.
+func (p *Pipe) Execute(ctx context.Context) ([]*Result, *cmd.XbeeError) {
+	if len(p.commands) == 0 {
+		return nil, cmd.Error("pipeline has no command")
+	}
+	if cmd.IsDryRun(ctx) && !p.readOnly() {
+		cmd.Plan(ctx, "run %s", p)
+		results := make([]*Result, len(p.commands))
+		for i, c := range p.commands {
+			results[i] = &Result{CommandLine: c.String()}
+		}
+		return results, nil
+	}
+	if ctx == nil {
+		ctx = cmd.Context()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stdout := p.stdout
+	if p.file != nil {
+		f, err := p.file.OpenFileForCreation()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		stdout = f
+	}
+
+	n := len(p.commands)
+	stages := make([]*stage, n)
+	var previous *os.File // read end of the pipe feeding the current stage
+	for i, c := range p.commands {
+		s := &stage{index: i, command: c}
+		stages[i] = s
+		s.ctx, s.cancel = c.context(ctx)
+		defer s.cancel()
+		var xerr *cmd.XbeeError
+		if s.cmd, xerr = c.createCmd(s.ctx); xerr != nil {
+			closeQuietly(previous)
+			cancel()
+			p.wait(stages[:i])
+			return nil, xerr
+		}
+		if i == 0 {
+			if p.stdin != nil {
+				s.cmd.Stdin = p.stdin
+			}
+		} else {
+			s.cmd.Stdin = previous
+		}
+		var w *os.File
+		if i < n-1 {
+			r, w2, err := os.Pipe()
+			if err != nil {
+				closeQuietly(previous)
+				cancel()
+				p.wait(stages[:i])
+				return nil, cmd.Error("cannot create pipe for pipeline [%s] : %v", p, err)
+			}
+			w = w2
+			s.cmd.Stdout = w
+			previous = r
+		} else if stdout != nil {
+			s.cmd.Stdout = stdout
+		}
+		s.release = c.killGroupOnCancel(s.cmd)
+		s.start = time.Now()
+		err := s.cmd.Start()
+		// the child has its own copies of pipe ends now
+		closeQuietly(w)
+		if i > 0 {
+			closeQuietly(s.cmd.Stdin.(*os.File))
+		}
+		if err != nil {
+			if i < n-1 {
+				closeQuietly(previous)
+			}
+			cancel()
+			p.wait(stages[:i])
+			return nil, cmd.Error("cannot start stage %d [%s] of pipeline [%s] : %v", i+1, c, p, err)
+		}
+	}
+
+	results, failed := p.wait(stages)
+	if failed == nil {
+		return results, nil
+	}
+	result := results[failed.index]
+	reason := fmt.Sprintf("exited with code %d", result.ExitCode)
+	switch {
+	case errors.Is(context.Cause(failed.ctx), errTimeout):
+		reason = fmt.Sprintf("killed by timeout after %s", failed.command.timeout)
+	case failed.ctx.Err() != nil:
+		reason = fmt.Sprintf("cancelled : %v", failed.ctx.Err())
+	case result.Signal != "":
+		reason = fmt.Sprintf("killed by signal %s", result.Signal)
+	}
+	err := cmd.Error("stage %d [%s] of pipeline [%s] %s%s",
+		failed.index+1, failed.command, p, reason, lastLines(result.Stderr, stderrLinesInError))
+	if category := failed.err.Category(); category != "" {
+		err = cmd.Wrap(category, err)
+	}
+	return results, err
+}
+
+// readOnly returns true if no command of the pipeline has side effects, and no output file is created.
+func (p *Pipe) readOnly() bool {
+	if p.file != nil {
+		return false
+	}
+	for _, c := range p.commands {
+		if !c.readOnly {
+			return false
+		}
+	}
+	return true
+}
+
+type stage struct {
+	index   int
+	command *Command
+	cmd     *exec.Cmd
+	ctx     context.Context
+	cancel  context.CancelFunc
+	start   time.Time
+	release func()
+	err     *cmd.XbeeError
+}
+
+// wait waits for all started stages and returns their results, and the stage to blame if any failed.
+func (p *Pipe) wait(stages []*stage) ([]*Result, *stage) {
+	results := make([]*Result, len(stages))
+	var failed, broken *stage
+	for i, s := range stages {
+		err := s.cmd.Wait()
+		s.release()
+		results[i], s.err = s.command.outcome(s.ctx, s.cmd, s.start, err)
+		if s.err == nil {
+			continue
+		}
+		if results[i].Signal == "broken pipe" {
+			if broken == nil {
+				broken = s
+			}
+		} else if failed == nil {
+			failed = s
+		}
+	}
+	if failed == nil {
+		failed = broken
+	}
+	return results, failed
+}
+
+func closeQuietly(f *os.File) {
+	if f != nil {
+		_ = f.Close()
+	}
+}
@@ -0,0 +1,132 @@
+package exec2
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+)
+
+func Test_PipelineChainsStdoutToStdin(t *testing.T) {
+	var out bytes.Buffer
+	if err := Pipeline(NewCommand("printf", `a\nb\n`).Quiet(), NewCommand("sort", "-r").Quiet()).WithStdout(&out).Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "b\na\n" {
+		t.Errorf("expected sorted lines, actual is %q", out.String())
+	}
+	out.Reset()
+	results, err := Pipeline(NewCommand("printf", `a\nb\n`).Quiet(), NewCommand("sort", "-r").Quiet(), NewCommand("wc", "-l").Quiet()).WithStdout(&out).Execute(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "2" {
+		t.Errorf("expected 2 lines counted, actual is %q", out.String())
+	}
+	if len(results) != 3 {
+		t.Errorf("expected a result per stage, actual are %v", results)
+	}
+}
+
+func Test_PipelineFailingStage(t *testing.T) {
+	results, err := Pipeline(
+		NewCommand("echo", "x").Quiet(),
+		NewCommand("sh", "-c", "cat > /dev/null; echo bad input >&2; exit 4").Quiet(),
+		NewCommand("cat").Quiet(),
+	).Execute(context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if results[1].ExitCode != 4 || results[0].ExitCode != 0 || results[2].ExitCode != 0 {
+		t.Errorf("unexpected exit codes %d, %d, %d", results[0].ExitCode, results[1].ExitCode, results[2].ExitCode)
+	}
+	message := err.Tree().Message
+	if !strings.HasPrefix(message, "stage 2 [sh -c") || !strings.Contains(message, "exited with code 4") || !strings.HasSuffix(message, "\nbad input") {
+		t.Errorf("expected the failing stage, its exit code and stderr, actual is %q", message)
+	}
+}
+
+func Test_PipelineBrokenPipeNotBlamed(t *testing.T) {
+	// yes writes until its stdout is closed by the failing stage
+	results, err := Pipeline(NewCommand("yes").Quiet(), NewCommand("sh", "-c", "exit 5").Quiet()).Execute(context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if results[0].Signal != "broken pipe" {
+		t.Errorf("expected the upstream stage killed by SIGPIPE, actual signal is %q", results[0].Signal)
+	}
+	if message := err.Tree().Message; !strings.HasPrefix(message, "stage 2 [") || !strings.Contains(message, "exited with code 5") {
+		t.Errorf("expected the downstream stage to be blamed, actual is %q", message)
+	}
+}
+
+func Test_PipelineCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	results, err := Pipeline(
+		NewCommand("sleep", "30").WithWaitDelay(time.Second).Quiet(),
+		NewCommand("sleep", "30").WithWaitDelay(time.Second).Quiet(),
+	).Execute(ctx)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("pipeline stopped after %v", elapsed)
+	}
+	for i, result := range results {
+		if result.ExitCode != -1 {
+			t.Errorf("expected stage %d to be killed, actual exit code is %d", i+1, result.ExitCode)
+		}
+	}
+	if message := err.Tree().Message; !strings.Contains(message, "cancelled") {
+		t.Errorf("expected a cancelled stage, actual is %q", message)
+	}
+}
+
+// createdFile is a FileCreator creating path.
+type createdFile string
+
+func (f createdFile) OpenFileForCreation() (*os.File, *cmd.XbeeError) {
+	file, err := os.Create(string(f))
+	if err != nil {
+		return nil, cmd.Error("cannot create %s : %v", f, err)
+	}
+	return file, nil
+}
+
+func Test_PipelineStdinToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	err := Pipeline(NewCommand("tr", "a-z", "A-Z").Quiet(), NewCommand("rev").Quiet()).
+		WithStdin(strings.NewReader("hello\nworld\n")).ToFile(createdFile(path)).Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err2 := os.ReadFile(path)
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if string(data) != "OLLEH\nDLROW\n" {
+		t.Errorf("expected stdin transformed into the file, actual is %q", data)
+	}
+}
+
+func Test_PipelineDryRun(t *testing.T) {
+	dryRun := cmd.GlobalOption("dry-run")
+	dryRun.Enable(true)
+	defer dryRun.Enable(false)
+	results, err := Pipeline(NewCommand("tar", "-cf", "-", "."), NewCommand("gzip")).Execute(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, result := range results {
+		if result == nil || result.ExitCode != 0 {
+			t.Errorf("expected a planned result for stage %d, actual is %v", i+1, result)
+		}
+	}
+}
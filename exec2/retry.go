@@ -0,0 +1,157 @@
+package exec2
+
+import (
+	"context"
+	"math/rand/v2"
+	"regexp"
+	"time"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/log2"
+)
+
+// Attempt is the outcome of one failed attempt, given to the predicates of a RetryPolicy.
+// ExitCode is -1 if the operation is not a process or was killed.
+type Attempt struct {
+	Number   int
+	ExitCode int
+	Stderr   string
+	TimedOut bool // the attempt timeout expired
+	Err      *cmd.XbeeError
+}
+
+// RetryPolicy retries failed operations with an exponential backoff. It can be shared, and a nil policy runs
+// operations once.
+type RetryPolicy struct {
+	maxAttempts    int
+	initialDelay   time.Duration
+	maxDelay       time.Duration
+	jitter         float64
+	attemptTimeout time.Duration
+	predicates     []func(a *Attempt) bool
+}
+
+// NewRetryPolicy runs an operation at most maxAttempts times. Delay between attempts starts at 1s, doubles
+// after each attempt up to 30s, and varies randomly of 20%.
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		maxAttempts:  max(maxAttempts, 1),
+		initialDelay: time.Second,
+		maxDelay:     30 * time.Second,
+		jitter:       0.2,
+	}
+}
+
+func (rp *RetryPolicy) WithBackoff(initial time.Duration, maxDelay time.Duration) *RetryPolicy {
+	rp.initialDelay = initial
+	rp.maxDelay = maxDelay
+	return rp
+}
+
+// WithJitter sets the random variation of delays, as a fraction between 0 and 1.
+func (rp *RetryPolicy) WithJitter(fraction float64) *RetryPolicy {
+	rp.jitter = min(max(fraction, 0), 1)
+	return rp
+}
+
+// WithAttemptTimeout cancels each attempt after d. An attempt cancelled this way is always retried.
+func (rp *RetryPolicy) WithAttemptTimeout(d time.Duration) *RetryPolicy {
+	rp.attemptTimeout = d
+	return rp
+}
+
+// RetryOnExitCodes retries attempts failing with one of codes.
+func (rp *RetryPolicy) RetryOnExitCodes(codes ...int) *RetryPolicy {
+	return rp.RetryOn(func(a *Attempt) bool {
+		for _, code := range codes {
+			if a.ExitCode == code {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RetryOnStderr retries attempts whose stderr matches re, for instance regexp.MustCompile("connection (reset|refused)").
+func (rp *RetryPolicy) RetryOnStderr(re *regexp.Regexp) *RetryPolicy {
+	return rp.RetryOn(func(a *Attempt) bool {
+		return re.MatchString(a.Stderr)
+	})
+}
+
+// RetryOn retries attempts for which f returns true. Without any predicate, every failure is retried.
+func (rp *RetryPolicy) RetryOn(f func(a *Attempt) bool) *RetryPolicy {
+	rp.predicates = append(rp.predicates, f)
+	return rp
+}
+
+func (rp *RetryPolicy) retryable(a *Attempt) bool {
+	if a.TimedOut || len(rp.predicates) == 0 {
+		return true
+	}
+	for _, f := range rp.predicates {
+		if f(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the delay before attempt number n+1.
+func (rp *RetryPolicy) delay(n int) time.Duration {
+	d := rp.initialDelay
+	for i := 1; i < n && d < rp.maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, rp.maxDelay)
+	return time.Duration(float64(d) * (1 + rp.jitter*(2*rand.Float64()-1)))
+}
+
+// Do runs f until it succeeds, its failure is not retryable, attempts are exhausted or ctx is done.
+// f returns the exit code and stderr of the operation, used by predicates. Retries are logged with name.
+// The error of the last attempt is returned.
+func (rp *RetryPolicy) Do(ctx context.Context, name string, f func(ctx context.Context) (exitCode int, stderr string, err *cmd.XbeeError)) *cmd.XbeeError {
+	if ctx == nil {
+		ctx = cmd.Context()
+	}
+	if rp == nil {
+		_, _, err := f(ctx)
+		return err
+	}
+	for n := 1; ; n++ {
+		attempt := rp.attempt(ctx, n, f)
+		if attempt.Err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !rp.retryable(attempt) {
+			return attempt.Err
+		}
+		if n >= rp.maxAttempts {
+			log2.Warnf("%s failed %d times, giving up", name, n)
+			return attempt.Err
+		}
+		d := rp.delay(n)
+		log2.Warnf("%s failed (attempt %d/%d, exit code %d), retrying in %s", name, n, rp.maxAttempts, attempt.ExitCode, d.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return attempt.Err
+		case <-time.After(d):
+		}
+	}
+}
+
+func (rp *RetryPolicy) attempt(ctx context.Context, n int, f func(ctx context.Context) (int, string, *cmd.XbeeError)) *Attempt {
+	attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+	if rp.attemptTimeout > 0 {
+		attemptCtx, cancel = context.WithTimeout(ctx, rp.attemptTimeout)
+	}
+	defer cancel()
+	exitCode, stderr, err := f(attemptCtx)
+	return &Attempt{
+		Number:   n,
+		ExitCode: exitCode,
+		Stderr:   stderr,
+		TimedOut: err != nil && ctx.Err() == nil && attemptCtx.Err() != nil,
+		Err:      err,
+	}
+}
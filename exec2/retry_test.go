@@ -0,0 +1,69 @@
+package exec2
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+)
+
+func Test_RetryUntilSuccess(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "counter")
+	// fails twice with exit code 75, then succeeds
+	script := `n=$(cat ` + counter + ` 2>/dev/null || echo 0); n=$((n+1)); echo $n > ` + counter + `; [ $n -ge 3 ] || { echo "temporary failure" >&2; exit 75; }`
+	policy := NewRetryPolicy(5).WithBackoff(time.Millisecond, 10*time.Millisecond).RetryOnExitCodes(75)
+	result, err := NewCommand("sh", "-c", script).WithRetry(policy).Quiet().Execute(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("expected exit code 0, actual is %d", result.ExitCode)
+	}
+}
+
+func Test_RetryNotRetryable(t *testing.T) {
+	attempts := 0
+	policy := NewRetryPolicy(5).WithBackoff(time.Millisecond, time.Millisecond).RetryOnStderr(regexp.MustCompile("connection reset"))
+	err := policy.Do(context.Background(), "test", func(ctx context.Context) (int, string, *cmd.XbeeError) {
+		attempts++
+		return 1, "permission denied", cmd.Error("failed")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("expected one failed attempt, actual is %d attempts and error %v", attempts, err)
+	}
+}
+
+func Test_RetryAttemptTimeout(t *testing.T) {
+	policy := NewRetryPolicy(2).WithBackoff(time.Millisecond, time.Millisecond).WithAttemptTimeout(50 * time.Millisecond)
+	start := time.Now()
+	_, err := NewCommand("sleep", "10").WithRetry(policy).Quiet().Execute(context.Background())
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("attempts were not cancelled, elapsed is %s", elapsed)
+	}
+}
+
+// failingRunner fails without Result, as a Runner may do when the command cannot start.
+type failingRunner struct{ runs int }
+
+func (r *failingRunner) Run(context.Context, *Command) (*Result, *cmd.XbeeError) {
+	r.runs++
+	return nil, cmd.Error("cannot start")
+}
+
+func Test_RetryWithoutResult(t *testing.T) {
+	r := &failingRunner{}
+	defer SetRunner(r)()
+	policy := NewRetryPolicy(2).WithBackoff(time.Millisecond, time.Millisecond)
+	if _, err := NewCommand("true").WithRetry(policy).Quiet().Execute(context.Background()); err == nil {
+		t.Errorf("expected an error")
+	}
+	if r.runs != 2 {
+		t.Errorf("expected 2 attempts, actual is %d", r.runs)
+	}
+}
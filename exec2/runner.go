@@ -0,0 +1,44 @@
+package exec2
+
+import (
+	"context"
+	"sync"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+)
+
+// A Runner executes commands. The default Runner starts processes ; a Recorder or a Replayer can replace it
+// with SetRunner, so that code built on exec2 can be tested without the real binaries. Pipelines always start processes.
+type Runner interface {
+	Run(ctx context.Context, c *Command) (*Result, *cmd.XbeeError)
+}
+
+type processRunner struct{}
+
+func (processRunner) Run(ctx context.Context, c *Command) (*Result, *cmd.XbeeError) {
+	return c.startAndWait(ctx)
+}
+
+var (
+	runnerLock sync.RWMutex
+	runner     Runner = processRunner{}
+)
+
+// SetRunner replaces the Runner of all commands, and returns a function restoring the previous one.
+func SetRunner(r Runner) (restore func()) {
+	runnerLock.Lock()
+	defer runnerLock.Unlock()
+	previous := runner
+	runner = r
+	return func() {
+		runnerLock.Lock()
+		defer runnerLock.Unlock()
+		runner = previous
+	}
+}
+
+func currentRunner() Runner {
+	runnerLock.RLock()
+	defer runnerLock.RUnlock()
+	return runner
+}
@@ -0,0 +1,80 @@
+package exec2
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+)
+
+// loginPath is the PATH of a login environment, as set by su.
+const loginPath = "/usr/local/bin:/usr/bin:/bin"
+
+// switchUser makes aCmd run as c.user, with the environment of this user, unless c.user is the current user.
+func (c *Command) switchUser(aCmd *exec.Cmd) *cmd.XbeeError {
+	if c.user == "" {
+		return nil
+	}
+	current, err := user.Current()
+	if err != nil {
+		return cmd.Error("cannot get current user : %v", err)
+	}
+	if current.Username == c.user {
+		return nil
+	}
+	target, err := user.Lookup(c.user)
+	if err != nil {
+		return cmd.Error("cannot run [%s] as %s : %v", c, c.user, err)
+	}
+	env := aCmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	if c.login {
+		env = loginEnv(env, c.env)
+		if info, err := os.Stat(target.HomeDir); aCmd.Dir == "" && err == nil && info.IsDir() {
+			aCmd.Dir = target.HomeDir
+		}
+	}
+	aCmd.Env = append(withoutVars(env, "HOME", "USER", "LOGNAME"),
+		"HOME="+target.HomeDir, "USER="+target.Username, "LOGNAME="+target.Username)
+	return c.runAs(aCmd, target)
+}
+
+// loginEnv keeps TERM from env, as su -l does, and adds extra variables set by WithEnv.
+func loginEnv(env []string, extra []string) []string {
+	result := []string{"PATH=" + loginPath}
+	for _, elt := range env {
+		if strings.HasPrefix(elt, "TERM=") {
+			result = append(result, elt)
+		}
+	}
+	return append(result, extra...)
+}
+
+func withoutVars(env []string, keys ...string) (result []string) {
+	for _, elt := range env {
+		key, _, _ := strings.Cut(elt, "=")
+		keep := true
+		for _, k := range keys {
+			if key == k {
+				keep = false
+			}
+		}
+		if keep {
+			result = append(result, elt)
+		}
+	}
+	return
+}
+
+// shellJoin quotes args for sh -c.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
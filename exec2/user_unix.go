@@ -0,0 +1,79 @@
+//go:build !windows
+
+package exec2
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+)
+
+// euid returns the effective user id, replaced by tests.
+var euid = os.Geteuid
+
+// runAs switches to target with setuid when running as root, otherwise through sudo, or su as a last resort.
+// sudo and su set the environment themselves : variables of WithEnv are given through env, and a login shell
+// changes to the directory of WithDirectory explicitly.
+func (c *Command) runAs(aCmd *exec.Cmd, target *user.User) *cmd.XbeeError {
+	if euid() == 0 {
+		credential, err := credentialOf(target)
+		if err != nil {
+			return err
+		}
+		aCmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+		return nil
+	}
+	args := aCmd.Args
+	if len(c.env) > 0 {
+		args = append(append([]string{"env"}, c.env...), args...)
+	}
+	if c.login && c.directory != "" {
+		args = []string{"sh", "-c", "cd " + shellJoin([]string{c.directory}) + " && exec " + shellJoin(args)}
+	}
+	if sudo, err := exec.LookPath("sudo"); err == nil {
+		mode := "-H"
+		if c.login {
+			mode = "-i"
+		}
+		aCmd.Args = append([]string{"sudo", "-n", mode, "-u", target.Username, "--"}, args...)
+		aCmd.Path, aCmd.Err = sudo, nil
+		return nil
+	}
+	su, err := exec.LookPath("su")
+	if err != nil {
+		return cmd.Error("cannot run [%s] as %s : neither sudo nor su found", c, target.Username)
+	}
+	suArgs := []string{"su"}
+	if c.login {
+		suArgs = append(suArgs, "-l")
+	}
+	aCmd.Args = append(suArgs, target.Username, "-c", shellJoin(args))
+	aCmd.Path, aCmd.Err = su, nil
+	return nil
+}
+
+func credentialOf(target *user.User) (*syscall.Credential, *cmd.XbeeError) {
+	uid, err := strconv.ParseUint(target.Uid, 10, 32)
+	if err != nil {
+		return nil, cmd.Error("invalid uid %s for user %s", target.Uid, target.Username)
+	}
+	gid, err := strconv.ParseUint(target.Gid, 10, 32)
+	if err != nil {
+		return nil, cmd.Error("invalid gid %s for user %s", target.Gid, target.Username)
+	}
+	credential := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	groupIds, err := target.GroupIds()
+	if err != nil {
+		return nil, cmd.Error("cannot get groups of user %s : %v", target.Username, err)
+	}
+	for _, id := range groupIds {
+		if group, err := strconv.ParseUint(id, 10, 32); err == nil {
+			credential.Groups = append(credential.Groups, uint32(group))
+		}
+	}
+	return credential, nil
+}
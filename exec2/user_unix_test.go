@@ -0,0 +1,146 @@
+//go:build !windows
+
+package exec2
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// targetUser returns nobody, tests switching user need root, as in a container.
+func targetUser(t *testing.T) *user.User {
+	if os.Geteuid() != 0 {
+		t.Skip("cannot run this test: it must run as root")
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skipf("cannot run this test: user nobody does not exist : %v", err)
+	}
+	return u
+}
+
+func Test_WithUser(t *testing.T) {
+	u := targetUser(t)
+	c := NewCommand("sh", "-c", `id -u; echo "$HOME $USER $LOGNAME $GREETING"`).
+		WithUser(u.Username).
+		WithEnv([]string{"GREETING=hello"}).
+		WithResult().Quiet()
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := u.Uid + "\n" + u.HomeDir + " nobody nobody hello\n"
+	if c.Result() != expected {
+		t.Errorf("expected %q, actual is %q", expected, c.Result())
+	}
+}
+
+func Test_WithUserLogin(t *testing.T) {
+	u := targetUser(t)
+	t.Setenv("NOT_IN_LOGIN", "x")
+	c := NewCommand("sh", "-c", `echo "$HOME $USER [$NOT_IN_LOGIN] $PATH"`).
+		WithUser(u.Username).WithLogin().
+		WithResult().Quiet()
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := u.HomeDir + " nobody [] " + loginPath + "\n"
+	if c.Result() != expected {
+		t.Errorf("expected %q, actual is %q", expected, c.Result())
+	}
+}
+
+// fakeBin returns a folder holding scripts, sh and env, to be used as PATH.
+func fakeBin(t *testing.T, scripts map[string]string) string {
+	bin := t.TempDir()
+	for _, tool := range []string{"sh", "env"} {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(path, filepath.Join(bin, tool)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return bin
+}
+
+// fakeSudo and fakeSu reset the environment, and start in / as a login shell would start in the home directory.
+const fakeSudo = `#!/bin/sh
+login=
+while [ "$1" != "--" ]; do [ "$1" = "-i" ] && login=1; shift; done
+shift
+[ -n "$login" ] && cd /
+exec env -i PATH="$PATH" "$@"
+`
+
+const fakeSu = `#!/bin/sh
+[ "$1" = "-l" ] && { cd /; shift; }
+[ "$2" = "-c" ] || exit 2
+exec env -i PATH="$PATH" sh -c "$3"
+`
+
+func Test_WithUserNotRoot(t *testing.T) {
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skipf("cannot run this test: user nobody does not exist : %v", err)
+	}
+	restore := euid
+	defer func() { euid = restore }()
+	euid = func() int { return 1000 }
+	for _, tool := range []string{"sudo", "su"} {
+		for _, login := range []bool{false, true} {
+			t.Run(tool+"/login="+strconv.FormatBool(login), func(t *testing.T) {
+				scripts := map[string]string{"su": fakeSu}
+				if tool == "sudo" {
+					scripts["sudo"] = fakeSudo
+				}
+				t.Setenv("PATH", fakeBin(t, scripts))
+				dir := t.TempDir()
+				c := NewCommand("sh", "-c", `echo "$GREETING $(pwd)"`).
+					WithUser(u.Username).WithEnv([]string{"GREETING=hello world"}).WithDirectory(dir).
+					WithResult().Quiet()
+				if login {
+					c.WithLogin()
+				}
+				if err := c.Run(context.Background()); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if expected := "hello world " + dir + "\n"; c.Result() != expected {
+					t.Errorf("expected %q, actual is %q", expected, c.Result())
+				}
+			})
+		}
+	}
+}
+
+func Test_WithCurrentUser(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := NewCommand("id", "-un").WithUser(current.Username).WithResult().Quiet()
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.TrimSpace(c.Result()) != current.Username {
+		t.Errorf("expected %s, actual is %q", current.Username, c.Result())
+	}
+}
+
+func Test_WithUnknownUser(t *testing.T) {
+	err := NewCommand("true").WithUser("xbee-unknown-user").Quiet().Run(context.Background())
+	if err == nil {
+		t.Errorf("expected an error for an unknown user")
+	}
+}
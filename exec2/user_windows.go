@@ -0,0 +1,12 @@
+package exec2
+
+import (
+	"os/exec"
+	"os/user"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+)
+
+func (c *Command) runAs(_ *exec.Cmd, target *user.User) *cmd.XbeeError {
+	return cmd.Error("cannot run [%s] as %s : switching user is not supported on windows", c, target.Username)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/iodasolutions/xbee-common/newfs"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -16,6 +17,10 @@ const publicBucket = "xbee.repository.public"
 
 var PrivateBucket = "xbee.repository"
 
+// gitNoTag matches the stderr of git describe when no tag can describe the commit. Its exit code, 128, is the
+// one of any fatal error of git.
+var gitNoTag = regexp.MustCompile(`No names found|No tags can describe|cannot describe anything`)
+
 var osArchs = [][]string{
 	{
 		"windows", "amd64",
@@ -63,16 +68,17 @@ func createArchive(binFile newfs.File, osName string) (newfs.File, *cmd.XbeeErro
 }
 
 func CommitAndRelease(ctx context.Context) (string, string, *cmd.XbeeError) {
-	commit, err := exec2.RunReturnStdOut(ctx, "git", "rev-parse", "HEAD")
-	if err != nil {
+	c := exec2.NewCommand("git", "rev-parse", "HEAD").ReadOnly().WithResult()
+	if err := c.Run(ctx); err != nil {
 		return "", "", err
 	}
-	aCmd := exec2.NewCommand("git", "describe", "--tags", commit).Quiet()
-	var release string
-	if err := aCmd.Run(ctx); err == nil {
-		release = aCmd.Result()
+	commit := c.Result()
+	// release is left empty when no tag can describe the commit
+	result, err := exec2.NewCommand("git", "describe", "--tags", strings.TrimSpace(commit)).Quiet().ReadOnly().WithResult().Execute(ctx)
+	if err != nil && !gitNoTag.MatchString(result.Stderr) {
+		return "", "", err
 	}
-	return strings.TrimSpace(commit), strings.TrimSpace(release), nil
+	return strings.TrimSpace(commit), strings.TrimSpace(result.Stdout), nil
 }
 
 func BuildAndDeploy(ctx context.Context, srcMainPath string, execName string) *cmd.XbeeError {
@@ -0,0 +1,52 @@
+package indus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iodasolutions/xbee-common/exec2"
+)
+
+func replay(t *testing.T, cassette string) *exec2.Replayer {
+	r, err := exec2.NewReplayer(cassette)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(exec2.SetRunner(r))
+	return r
+}
+
+func Test_CommitAndRelease(t *testing.T) {
+	tests := []struct {
+		cassette string
+		release  string
+	}{
+		{"testdata/release.yaml", "v1.2.0"},
+		{"testdata/no_tag.yaml", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cassette, func(t *testing.T) {
+			r := replay(t, tt.cassette)
+			commit, release, err := CommitAndRelease(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if commit != "4c807c1e9a0d4f1b2a3c5d6e7f8091a2b3c4d5e6" {
+				t.Errorf("unexpected commit: %q", commit)
+			}
+			if release != tt.release {
+				t.Errorf("expected release %q, actual is %q", tt.release, release)
+			}
+			if unused := r.Unused(); len(unused) > 0 {
+				t.Errorf("%d interactions not replayed", len(unused))
+			}
+		})
+	}
+}
+
+func Test_CommitAndReleaseOutsideRepository(t *testing.T) {
+	replay(t, "testdata/not_a_repository.yaml")
+	if _, _, err := CommitAndRelease(context.Background()); err == nil {
+		t.Errorf("expected an error, a fatal git error is not a missing tag")
+	}
+}
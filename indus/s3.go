@@ -9,9 +9,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/exec2"
 	"github.com/iodasolutions/xbee-common/log2"
 	"github.com/iodasolutions/xbee-common/newfs"
-	"log"
 	"os"
 	"strings"
 )
@@ -22,6 +22,7 @@ var s1 string
 type S3 struct {
 	s3     *s3.Client
 	bucket string
+	retry  *exec2.RetryPolicy
 }
 
 func AdminClient(bucket string) (*S3, *cmd.XbeeError) {
@@ -29,7 +30,7 @@ func AdminClient(bucket string) (*S3, *cmd.XbeeError) {
 	if err != nil {
 		return nil, cmd.Error("cannot create s3 client: %v", err)
 	}
-	return &S3{s3.NewFromConfig(cfg), bucket}, nil
+	return &S3{s3: s3.NewFromConfig(cfg), bucket: bucket}, nil
 }
 
 func ReadClient() *S3 {
@@ -41,58 +42,92 @@ func ReadClient() *S3 {
 		Region:      "eu-west-3",
 		Credentials: credentials.NewStaticCredentialsProvider(n1, s1, ""),
 	}
-	return &S3{s3.NewFromConfig(cfg), PrivateBucket}
+	return &S3{s3: s3.NewFromConfig(cfg), bucket: PrivateBucket}
 }
 
-func (svc *S3) HasEntry(ctx context.Context, key string) (bool, *cmd.XbeeError) {
-	_, err := svc.s3.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: &svc.bucket,
-		Key:    &key,
+// WithRetry retries failed s3 operations as defined by policy. Error messages are matched by RetryOnStderr.
+func (svc *S3) WithRetry(policy *exec2.RetryPolicy) *S3 {
+	svc.retry = policy
+	return svc
+}
+
+// do runs f with the retry policy of svc.
+func (svc *S3) do(ctx context.Context, name string, f func(ctx context.Context) *cmd.XbeeError) *cmd.XbeeError {
+	return svc.retry.Do(ctx, name, func(ctx context.Context) (int, string, *cmd.XbeeError) {
+		if err := f(ctx); err != nil {
+			return -1, err.Error(), err
+		}
+		return 0, "", nil
 	})
-	if err != nil {
-		message := err.Error()
-		if strings.Contains(message, "StatusCode: 404") {
-			return false, nil
-		} else {
-			return false, cmd.Error("Unknown S3 Error: %v", err)
+}
+
+func (svc *S3) HasEntry(ctx context.Context, key string) (bool, *cmd.XbeeError) {
+	var found bool
+	err := svc.do(ctx, "s3 head "+key, func(ctx context.Context) *cmd.XbeeError {
+		_, err := svc.s3.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: &svc.bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			message := err.Error()
+			if strings.Contains(message, "StatusCode: 404") {
+				found = false
+				return nil
+			} else {
+				return cmd.Error("Unknown S3 Error: %v", err)
+			}
 		}
-	}
-	return true, nil
+		found = true
+		return nil
+	})
+	return found, err
 }
 
 func (svc *S3) Upload(ctx context.Context, f newfs.File, key string) *cmd.XbeeError {
-	file, err2 := os.Open(f.String())
-	if err2 != nil {
-		return cmd.Error("cannot open file %s: %v", f, err2)
-	}
-	defer file.Close()
-	_, err2 = svc.s3.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: &svc.bucket,
-		Key:    &key,
-		Body:   file,
+	err := svc.do(ctx, "s3 upload "+key, func(ctx context.Context) *cmd.XbeeError {
+		file, err2 := os.Open(f.String())
+		if err2 != nil {
+			return cmd.Error("cannot open file %s: %v", f, err2)
+		}
+		defer file.Close()
+		_, err2 = svc.s3.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: &svc.bucket,
+			Key:    &key,
+			Body:   file,
+		})
+		if err2 != nil {
+			return cmd.Error("cannot upload file %s to s3: %v", f, err2)
+		}
+		return nil
 	})
-	if err2 != nil {
-		return cmd.Error("cannot upload file %s to s3: %v", f, err2)
+	if err != nil {
+		return err
 	}
 	fmt.Printf("Upload OK (%s)\n", f)
 	return nil
 }
 
 func (svc *S3) Download(ctx context.Context, key string, targetFile newfs.File) *cmd.XbeeError {
-	f, err := targetFile.OpenFileForCreation()
+	err := svc.do(ctx, "s3 download "+key, func(ctx context.Context) *cmd.XbeeError {
+		f, err := targetFile.OpenFileForCreation()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		downloader := manager.NewDownloader(svc.s3)
+		// Télécharger l'objet
+		_, err2 := downloader.Download(ctx, f, &s3.GetObjectInput{
+			Bucket: &PrivateBucket,
+			Key:    &key,
+		})
+		if err2 != nil {
+			return cmd.Error("Unable to download item %s to %s, %v", key, targetFile, err2)
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	downloader := manager.NewDownloader(svc.s3)
-	// Télécharger l'objet
-	_, err2 := downloader.Download(ctx, f, &s3.GetObjectInput{
-		Bucket: &PrivateBucket,
-		Key:    &key,
-	})
-	if err2 != nil {
-		log.Fatalf("Unable to download item %s to %s, %v", key, targetFile, err)
-	}
 	log2.Infof("downloaded %s to %s from s3", key, targetFile)
 	return nil
 }
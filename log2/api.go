@@ -1,5 +1,7 @@
 package log2
 
+import "github.com/iodasolutions/xbee-common/cmd"
+
 func Debugf(format string, a ...interface{}) {
 	send(DEBUG, format, a...)
 }
@@ -13,6 +15,17 @@ func Errorf(format string, a ...interface{}) {
 	send(ERROR, format, a...)
 }
 
+// Logf returns the log function of level name, one of debug, info, warn or error, for instance to give it to
+// exec2.LineWriter.ToLog.
+func Logf(name string) (func(format string, a ...interface{}), *cmd.XbeeError) {
+	for _, l := range []level{DEBUG, INFO, WARN, ERROR} {
+		if l.String() == name {
+			return func(format string, a ...interface{}) { send(l, format, a...) }, nil
+		}
+	}
+	return nil, cmd.Error("unknown log level %s, expected one of debug, info, warn or error", name)
+}
+
 func Level() string {
 	return theLevel.value.String()
 }
@@ -24,7 +37,13 @@ func TurnOffIfNotSet() {
 	}
 }
 
+// Close flushes pending log lines. It is registered as a cmd.OnExit handler, and can be called several times.
 func Close() {
-	close(ch)
+	closeOnce.Do(func() {
+		closed.Lock()
+		defer closed.Unlock()
+		closed.done = true
+		close(ch)
+	})
 	<-chExit
 }
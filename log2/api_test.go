@@ -0,0 +1,9 @@
+package log2
+
+import "testing"
+
+func Test_LogAfterClose(t *testing.T) {
+	Close()
+	Infof("logged after close")
+	Close()
+}
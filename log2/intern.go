@@ -3,14 +3,25 @@ package log2
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/iodasolutions/xbee-common/cmd"
 )
 
 var ch = make(chan logElt)
 var chExit = make(chan bool)
+var closeOnce sync.Once
+
+// closed is set by Close : goroutines still logging then, like commands stopped by a second signal, write directly.
+var closed struct {
+	sync.RWMutex
+	done bool
+}
 
 func init() {
 	go consumeCh()
+	cmd.OnExit(Close)
 }
 
 func consumeCh() {
@@ -29,6 +40,12 @@ func send(l level, format string, a ...interface{}) {
 	if l >= value() {
 		message := fmt.Sprintf(format, a...)
 		log := buildLogLine(l, message)
+		closed.RLock()
+		defer closed.RUnlock()
+		if closed.done {
+			fmt.Print(log)
+			return
+		}
 		ch <- logElt{
 			message: log,
 		}
@@ -15,7 +15,7 @@ const (
 	OFF
 )
 
-var option = cmd.NewOption("log", "l", INFO.String()).WithDescription("Control log verbosity (info,debug,off)")
+var option = cmd.NewEnumOption("log", "l", INFO.String(), "debug", "info", "warn", "error", "off").WithDescription("Control log verbosity").WithEnvVar("XBEE_LOG")
 
 func init() {
 	cmd.Register(option)
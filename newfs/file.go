@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -125,11 +126,27 @@ func (f File) OpenFileForCreation() (*os.File, *cmd.XbeeError) {
 	return fd, nil
 }
 
+// EnsureDelete deletes f if it exists, unless in dry run.
 func (f File) EnsureDelete() *cmd.XbeeError {
+	return f.EnsureDeleteContext(nil)
+}
+
+// EnsureDeleteContext is EnsureDelete, the dry run setting being the one of the command run with ctx.
+func (f File) EnsureDeleteContext(ctx context.Context) *cmd.XbeeError {
 	if !f.Exists() {
 		return nil
 	}
-	if err := os.Remove(f.String()); err != nil {
+	if cmd.IsDryRun(ctx) {
+		cmd.Plan(ctx, "delete file %s", f)
+		return nil
+	}
+	return f.DeleteTemp()
+}
+
+// DeleteTemp deletes a temporary file, even in dry run : it was created whatever the mode, as a means and not
+// as a side effect.
+func (f File) DeleteTemp() *cmd.XbeeError {
+	if err := os.Remove(f.String()); err != nil && !os.IsNotExist(err) {
 		return cmd.Error("cannot remove %s: %v", f, err)
 	}
 	return nil
@@ -389,7 +406,16 @@ func (f File) Unzip() *cmd.XbeeError {
 	return nil
 }
 func (f File) Untar(destDir string) *cmd.XbeeError {
-	if err := NewFolder(destDir).EnsureEmpty(); err != nil {
+	return f.UntarContext(nil, destDir)
+}
+
+// UntarContext is Untar, the dry run setting being the one of the command run with ctx.
+func (f File) UntarContext(ctx context.Context, destDir string) *cmd.XbeeError {
+	if cmd.IsDryRun(ctx) {
+		cmd.Plan(ctx, "replace content of folder %s with archive %s", destDir, f)
+		return nil
+	}
+	if err := NewFolder(destDir).EnsureEmptyContext(ctx); err != nil {
 		return err
 	}
 	// Ouvrir le fichier .tar
@@ -1,6 +1,8 @@
 package newfs
 
 import (
+	"compress/gzip"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -38,8 +40,14 @@ func NewFolder(path string) Folder {
 	return Folder{Path(path)}
 }
 
+// EnsureEmpty creates fd, or deletes its content, see DeleteDirContent.
 func (fd Folder) EnsureEmpty() *cmd.XbeeError {
-	return fd.EnsureExists().DeleteDirContent()
+	return fd.EnsureEmptyContext(nil)
+}
+
+// EnsureEmptyContext is EnsureEmpty, the dry run setting being the one of the command run with ctx.
+func (fd Folder) EnsureEmptyContext(ctx context.Context) *cmd.XbeeError {
+	return fd.EnsureExists().DeleteDirContentContext(ctx)
 }
 
 func (fd Folder) EnsureExists() Folder {
@@ -59,10 +67,20 @@ func (fd Folder) Create() Folder {
 	return fd
 }
 
+// DeleteDirContent deletes children of fd, unless in dry run.
 func (fd Folder) DeleteDirContent() *cmd.XbeeError {
+	return fd.DeleteDirContentContext(nil)
+}
+
+// DeleteDirContentContext is DeleteDirContent, the dry run setting being the one of the command run with ctx.
+func (fd Folder) DeleteDirContentContext(ctx context.Context) *cmd.XbeeError {
 	if !fd.Exists() {
 		return nil
 	}
+	if cmd.IsDryRun(ctx) {
+		cmd.Plan(ctx, "delete content of folder %s", fd)
+		return nil
+	}
 	dir, err := os.Open(fd.String())
 	if err != nil {
 		return cmd.Error("cannot open %s : %v", fd, err)
@@ -82,9 +100,19 @@ func (fd Folder) DeleteDirContent() *cmd.XbeeError {
 	return nil
 }
 
+// Delete deletes fd and its content, unless in dry run.
 func (fd Folder) Delete() *cmd.XbeeError {
+	return fd.DeleteContext(nil)
+}
+
+// DeleteContext is Delete, the dry run setting being the one of the command run with ctx.
+func (fd Folder) DeleteContext(ctx context.Context) *cmd.XbeeError {
+	if fd.Exists() && cmd.IsDryRun(ctx) {
+		cmd.Plan(ctx, "delete folder %s", fd)
+		return nil
+	}
 	if fd.Exists() {
-		if err := fd.DeleteDirContent(); err != nil {
+		if err := fd.DeleteDirContentContext(ctx); err != nil {
 			return err
 		}
 		if err := os.Remove(fd.String()); err != nil {
@@ -243,16 +271,55 @@ func (fd Folder) CopyDirContentToDirKeepOwner(dstDir Folder, keepOwner bool) {
 }
 
 func (fd Folder) TarToFile(f File) *cmd.XbeeError {
-	var args []string
+	return fd.TarToFileContext(nil, f)
+}
+
+// TarToFileContext is TarToFile, the dry run setting being the one of the command run with ctx.
+func (fd Folder) TarToFileContext(ctx context.Context, f File) *cmd.XbeeError {
+	args := append(fd.tarExcludes(), "-cvf", f.String(), ".")
+	return exec2.NewCommand("tar", args...).WithDirectory(fd.String()).Run(ctx)
+}
+
+// tarExcludes returns tar options excluding pseudo and temporary filesystems when archiving the root folder.
+func (fd Folder) tarExcludes() []string {
 	if fd.String() == "/" {
-		args = strings.Split("--exclude=./dev --exclude=./proc --exclude=./sys --exclude=./tmp --exclude=./run --exclude=./mnt --exclude=./media --exclude=./lost+found --exclude=./xbee --exclude=./usr/bin/xbee", " ")
+		return strings.Split("--exclude=./dev --exclude=./proc --exclude=./sys --exclude=./tmp --exclude=./run --exclude=./mnt --exclude=./media --exclude=./lost+found --exclude=./xbee --exclude=./usr/bin/xbee", " ")
 	}
-	args = append(args, "-cvf", f.String(), ".")
-	aCmd := exec2.NewCommand("tar", args...).WithDirectory(fd.String())
-	err := aCmd.Run(nil)
-	out := aCmd.Result()
+	return nil
+}
+
+// TarGzToFile streams the archive of fd through an in-process gzip writer into f, without intermediate tar file.
+// f is removed if the archive cannot be written.
+func (fd Folder) TarGzToFile(f File) (err *cmd.XbeeError) {
+	return fd.TarGzToFileContext(nil, f)
+}
+
+// TarGzToFileContext is TarGzToFile, the dry run setting being the one of the command run with ctx.
+func (fd Folder) TarGzToFileContext(ctx context.Context, f File) (err *cmd.XbeeError) {
+	if cmd.IsDryRun(ctx) {
+		cmd.Plan(ctx, "archive folder %s into %s", fd, f)
+		return nil
+	}
+	out, err := f.OpenFileForCreation()
 	if err != nil {
-		return cmd.Error("This command [%s] failed : %s", aCmd.String(), out)
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.String())
+		}
+	}()
+	defer out.Close()
+	zw := gzip.NewWriter(out)
+	args := append(fd.tarExcludes(), "-cf", "-", ".")
+	if err := exec2.Pipeline(exec2.NewCommand("tar", args...).WithDirectory(fd.String()).Quiet()).WithStdout(zw).Run(ctx); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return cmd.Error("cannot compress archive into %s : %v", f, err)
+	}
+	if err := out.Close(); err != nil {
+		return cmd.Error("cannot write file %s : %v", f, err)
 	}
 	return nil
 }
@@ -269,18 +336,48 @@ func (fd Folder) ChModRecursive(mod os.FileMode) {
 }
 
 func (fd Folder) Compress(extension string, keepTar bool) (File, *cmd.XbeeError) {
-	return fd.CompressToDir(fd.Dir(), extension, keepTar)
+	return fd.CompressContext(nil, extension, keepTar)
+}
+
+// CompressContext is Compress, the dry run setting being the one of the command run with ctx.
+func (fd Folder) CompressContext(ctx context.Context, extension string, keepTar bool) (File, *cmd.XbeeError) {
+	return fd.CompressToDirContext(ctx, fd.Dir(), extension, keepTar)
 }
 
 // CompressToDir supports gz, zip
 func (fd Folder) CompressToDir(target Folder, extension string, keepTar bool) (File, *cmd.XbeeError) {
+	return fd.CompressToDirContext(nil, target, extension, keepTar)
+}
+
+// CompressToDirContext is CompressToDir, the dry run setting being the one of the command run with ctx.
+func (fd Folder) CompressToDirContext(ctx context.Context, target Folder, extension string, keepTar bool) (File, *cmd.XbeeError) {
 	target.EnsureExists()
-	return fd.CompressToPath(target.ChildFile(fd.Base()+"."+extension), keepTar)
+	return fd.CompressToPathContext(ctx, target.ChildFile(fd.Base()+"."+extension), keepTar)
 }
 
+// CompressToPath archives fd into <target without extension>.tar.<extension>, which is returned.
 func (fd Folder) CompressToPath(target File, keepTar bool) (File, *cmd.XbeeError) {
+	return fd.CompressToPathContext(nil, target, keepTar)
+}
+
+// CompressToPathContext is CompressToPath, the dry run setting being the one of the command run with ctx.
+func (fd Folder) CompressToPathContext(ctx context.Context, target File, keepTar bool) (File, *cmd.XbeeError) {
 	targetTar := target.Dir().ChildFile(target.BaseWithoutExtension() + ".tar")
-	if err := fd.TarToFile(targetTar); err != nil {
+	result := NewFile(targetTar.String() + "." + target.Extension())
+	if target.Extension() != "gz" && target.Extension() != "zip" {
+		return NewFile(""), cmd.Error("compression support only gz or zip, actual is [%s]", target.Extension())
+	}
+	if cmd.IsDryRun(ctx) {
+		cmd.Plan(ctx, "archive folder %s into %s", fd, result)
+		return result, nil
+	}
+	if target.Extension() == "gz" && !keepTar {
+		if err := fd.TarGzToFileContext(ctx, result); err != nil {
+			return NewFile(""), err
+		}
+		return result, nil
+	}
+	if err := fd.TarToFileContext(ctx, targetTar); err != nil {
 		return NewFile(""), err
 	}
 	result, err := targetTar.Compress(target.Extension())
@@ -288,7 +385,7 @@ func (fd Folder) CompressToPath(target File, keepTar bool) (File, *cmd.XbeeError
 		return NewFile(""), err
 	}
 	if !keepTar {
-		if err := targetTar.EnsureDelete(); err != nil {
+		if err := targetTar.DeleteTemp(); err != nil {
 			return NewFile(""), err
 		}
 	}
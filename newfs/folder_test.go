@@ -1,23 +1,33 @@
 package newfs
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"strings"
 	"testing"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/exec2"
 )
 
 func Test_TarToFolder(t *testing.T) {
 	fdA := TmpDir().ChildFolder("a").Create()
 	fdA.ChildFile("b.txt").SetContent("b")
 	fdA.ChildFile("c.txt").SetContent("c")
-	if err := fdA.TarToFile("/tmp/a.tar"); err != nil {
+	if err := fdA.TarToFile(NewFile("/tmp/a.tar")); err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
 
 }
 
 func Test_TarToFolderUsrBin(t *testing.T) {
-	fdA := Folder("/home/eric/CLionProjects")
+	fdA := NewFolder("/home/eric/CLionProjects")
 	if fdA.Exists() {
-		if err := fdA.TarToFile("/tmp/a.tar"); err != nil {
+		if err := fdA.TarToFile(NewFile("/tmp/a.tar")); err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 	} else {
@@ -25,3 +35,135 @@ func Test_TarToFolderUsrBin(t *testing.T) {
 	}
 
 }
+
+func Test_TarGzToFile(t *testing.T) {
+	fd := NewFolder(t.TempDir()).ChildFolder("a").Create()
+	fd.ChildFile("b.txt").SetContent("b")
+	target := NewFolder(t.TempDir()).ChildFile("a.tar.gz")
+	if err := fd.TarGzToFile(target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	archive, err := os.Open(target.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	zr, err := gzip.NewReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{}
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		contents[header.Name] = string(data)
+	}
+	if contents["./b.txt"] != "b" {
+		t.Errorf("expected ./b.txt with content b in archive, actual entries are %v", contents)
+	}
+
+	missing := NewFolder(t.TempDir()).ChildFolder("missing")
+	if err := missing.TarGzToFile(target); err == nil {
+		t.Errorf("expected an error for a missing folder")
+	}
+	if target.Exists() {
+		t.Errorf("partial archive %s not removed", target)
+	}
+}
+
+func Test_TarToFileReplay(t *testing.T) {
+	r, err := exec2.NewReplayer("testdata/tar.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer exec2.SetRunner(r)()
+	if err := NewFolder("/xbee/a").TarToFile(NewFile("/tmp/a.tar")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = NewFolder("/xbee/other").TarToFile(NewFile("/tmp/a.tar"))
+	if err == nil || !strings.Contains(err.Error(), "-directory: /xbee/missing") || !strings.Contains(err.Error(), "+directory: /xbee/other") {
+		t.Errorf("expected a diff for an unexpected folder, actual is %v", err)
+	}
+	if err := NewFolder("/xbee/missing").TarToFile(NewFile("/tmp/a.tar")); err == nil {
+		t.Errorf("expected an error for a missing folder")
+	}
+}
+
+func Test_CompressDryRun(t *testing.T) {
+	dryRun := cmd.GlobalOption("dry-run")
+	dryRun.Enable(true)
+	defer dryRun.Enable(false)
+	fd := NewFolder(t.TempDir()).ChildFolder("a").Create()
+	fd.ChildFile("b.txt").SetContent("b")
+	for _, extension := range []string{"gz", "zip"} {
+		before := len(cmd.PlannedActions(context.Background()))
+		result, err := fd.Compress(extension, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Exists() || fd.Dir().ChildFile("a.tar").Exists() {
+			t.Errorf("archive %s created in dry run", result)
+		}
+		actions := cmd.PlannedActions(context.Background())[before:]
+		expected := "archive folder " + fd.String() + " into " + fd.Dir().ChildFile("a.tar."+extension).String()
+		if len(actions) != 1 || actions[0] != expected {
+			t.Errorf("expected planned action %q, actual is %v", expected, actions)
+		}
+	}
+}
+
+func Test_DeleteDryRun(t *testing.T) {
+	dryRun := cmd.GlobalOption("dry-run")
+	dryRun.Enable(true)
+	defer dryRun.Enable(false)
+	fd := NewFolder(t.TempDir()).ChildFolder("a").Create()
+	fd.ChildFile("b.txt").SetContent("b")
+	if err := fd.Delete(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !fd.ChildFile("b.txt").Exists() {
+		t.Errorf("folder %s deleted in dry run", fd)
+	}
+	actions := cmd.PlannedActions(context.Background())
+	if len(actions) == 0 || actions[len(actions)-1] != "delete folder "+fd.String() {
+		t.Errorf("unexpected planned actions: %v", actions)
+	}
+}
+
+func Test_DeleteDryRunInApp(t *testing.T) {
+	fd := NewFolder(t.TempDir()).ChildFolder("a").Create()
+	fd.ChildFile("b.txt").SetContent("b")
+	root := cmd.NewCommand("root")
+	_ = root.AddCommands(
+		cmd.NewCommand("rm").WithRunE(func(ctx context.Context, _ []string) *cmd.XbeeError { return fd.DeleteContext(ctx) }),
+		cmd.NewCommand("rm-legacy").WithRun(func([]string) *cmd.XbeeError { return fd.Delete() }),
+	)
+	app := cmd.NewApp(root)
+	for _, leaf := range []string{"rm", "rm-legacy"} {
+		var out bytes.Buffer
+		app.Stdout = &out
+		if err := app.Execute(context.Background(), []string{"--dry-run", leaf}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !fd.ChildFile("b.txt").Exists() {
+			t.Fatalf("folder %s deleted by %s in dry run", fd, leaf)
+		}
+		expected := "[dry-run] would delete folder " + fd.String() + "\nDry run : 1 side effect(s) planned\n"
+		if !strings.HasPrefix(out.String(), expected) {
+			t.Errorf("expected output of %s starting with %q, actual is %q", leaf, expected, out.String())
+		}
+	}
+	if err := app.Execute(context.Background(), []string{"rm"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fd.Exists() {
+		t.Errorf("folder %s not deleted without dry run", fd)
+	}
+}
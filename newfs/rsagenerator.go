@@ -88,11 +88,15 @@ func (rg *RsaGenerator) EnsureRootKeysExist(ctx context.Context) {
 	defer lock.Unlock()
 	if !rg.HasRootKeys() {
 		log2.Infof("Generate Xbee Key...")
-		rg.createAndPersistRootCertificate()
+		rg.createAndPersistRootCertificate(ctx)
 	}
 }
-func (rg *RsaGenerator) createAndPersistRootCertificate() *cmd.XbeeError {
-	if err := rg.sshFolder.EnsureEmpty(); err != nil {
+func (rg *RsaGenerator) createAndPersistRootCertificate(ctx context.Context) *cmd.XbeeError {
+	if cmd.IsDryRun(ctx) {
+		cmd.Plan(ctx, "generate root keys in %s", rg.sshFolder)
+		return nil
+	}
+	if err := rg.sshFolder.EnsureEmptyContext(ctx); err != nil {
 		return err
 	}
 	rg.sshFolder.ChMod(0700)
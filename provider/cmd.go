@@ -2,9 +2,9 @@ package provider
 
 import (
 	"github.com/iodasolutions/xbee-common/cmd"
-	"github.com/iodasolutions/xbee-common/log2"
 	"github.com/iodasolutions/xbee-common/newfs"
 	"os"
+	"path/filepath"
 )
 
 var provider Provider
@@ -23,14 +23,17 @@ type Admin interface {
 }
 
 func Execute(p Provider, a Admin) {
-	defer func() {
-		log2.Close()
-	}()
+	defer cmd.RunCleanups()
 	provider = p
 	admin = a
+	cmd.SetProgramName(filepath.Base(os.Args[0]))
 	ok, err := cmd.Setup(buildCmdTree)
-	if !ok {
-		err = cmd.Error("unknown action : %s", os.Args[1])
+	if err == nil && !ok {
+		if len(os.Args) > 1 {
+			err = cmd.UsageError("unknown action : %s", os.Args[1])
+		} else {
+			err = cmd.UsageError("an action is required")
+		}
 	}
 	if err == nil {
 		err = cmd.Run()
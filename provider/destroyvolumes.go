@@ -4,8 +4,9 @@ import "github.com/iodasolutions/xbee-common/cmd"
 
 func destroyVolumesCommand() *cmd.Command {
 	return &cmd.Command{
-		Use: string(DestroyVolumes),
-		Run: doDestroyVolumes,
+		Use:      string(DestroyVolumes),
+		Run:      doDestroyVolumes,
+		Complete: CompleteVolumes,
 	}
 }
 
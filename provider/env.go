@@ -1,6 +1,8 @@
 package provider
 
 import (
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/iodasolutions/xbee-common/cmd"
@@ -121,6 +123,26 @@ func Hosts() (result map[string]*XbeeHost) {
 	return env.Env.Hosts
 }
 
+// CompleteHosts completes host names of the environment, see cmd.Command Complete.
+func CompleteHosts(_ []string, toComplete string) []string {
+	return completeKeys(Hosts(), toComplete)
+}
+
+// CompleteVolumes completes volume names of the environment, see cmd.Command Complete.
+func CompleteVolumes(_ []string, toComplete string) []string {
+	return completeKeys(VolumesForEnv(), toComplete)
+}
+
+func completeKeys[T any](m map[string]T, toComplete string) (result []string) {
+	for name := range m {
+		if strings.HasPrefix(name, toComplete) {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return
+}
+
 func VolumesForEnv() (result map[string]*XbeeVolume) {
 	env.once.Do(func() {
 		initEnv()
@@ -58,7 +58,7 @@ func InstanceInfosFromProviderFor(fd newfs.Folder) (instanceInfos InstanceInfos,
 		return
 	}
 	defer func() {
-		err2 := f.EnsureDelete()
+		err2 := f.DeleteTemp()
 		err = cmd.FollowedWith(err, err2)
 	}()
 	instanceInfos, err = newfs.Unmarshal[InstanceInfos](f)
@@ -0,0 +1,240 @@
+package ssh2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/exec2"
+	"github.com/iodasolutions/xbee-common/log2"
+	"golang.org/x/crypto/ssh"
+)
+
+// killDelay is the time left to the remote process to exit after SIGTERM, before SIGKILL is sent.
+const killDelay = 5 * time.Second
+
+// RemoteCommand is the remote counterpart of exec2.Command : a command run in its own session.
+type RemoteCommand struct {
+	client  *SSHClient
+	command string
+
+	quiet  bool
+	pty    bool
+	stdin  io.Reader
+	prefix string
+
+	user      string
+	directory string
+	env       []string
+
+	retry    *exec2.RetryPolicy
+	readOnly bool
+}
+
+// RemoteResult is the outcome of a RemoteCommand. ExitStatus is -1 if the remote side did not report it.
+type RemoteResult struct {
+	ExitStatus int
+	Signal     string
+	Stdout     string
+	Stderr     string
+}
+
+func (hr *SSHClient) NewCommand(command string) *RemoteCommand {
+	return &RemoteCommand{
+		client:  hr,
+		command: command,
+		prefix:  hr.RemoteAddr().String(),
+	}
+}
+
+func (rc *RemoteCommand) WithDirectory(dir string) *RemoteCommand {
+	rc.directory = dir
+	return rc
+}
+
+// WithUser runs the command as user through sudo.
+func (rc *RemoteCommand) WithUser(user string) *RemoteCommand {
+	rc.user = user
+	return rc
+}
+
+// WithEnv adds variables in the form KEY=VALUE. They are exported by the remote shell, since sshd usually rejects setenv requests.
+func (rc *RemoteCommand) WithEnv(env []string) *RemoteCommand {
+	rc.env = append(rc.env, env...)
+	return rc
+}
+
+func (rc *RemoteCommand) WithPty() *RemoteCommand {
+	rc.pty = true
+	return rc
+}
+
+func (rc *RemoteCommand) WithStdin(r io.Reader) *RemoteCommand {
+	rc.stdin = r
+	return rc
+}
+
+// WithPrefix sets the label put in front of each output line. Default is the remote address.
+func (rc *RemoteCommand) WithPrefix(prefix string) *RemoteCommand {
+	rc.prefix = prefix
+	return rc
+}
+
+// WithRetry runs the command again on failure, as defined by policy. The result of the last attempt is returned.
+// A reader given WithStdin is not replayed.
+func (rc *RemoteCommand) WithRetry(policy *exec2.RetryPolicy) *RemoteCommand {
+	rc.retry = policy
+	return rc
+}
+
+// ReadOnly marks a command without side effect, which runs even in dry run.
+func (rc *RemoteCommand) ReadOnly() *RemoteCommand {
+	rc.readOnly = true
+	return rc
+}
+
+func (rc *RemoteCommand) Quiet() *RemoteCommand {
+	rc.quiet = true
+	return rc
+}
+
+// String returns the command line really sent to the remote shell.
+func (rc *RemoteCommand) String() string {
+	s := rc.command
+	if rc.directory != "" {
+		s = fmt.Sprintf("cd %s && %s", shellQuote(rc.directory), s)
+	}
+	if len(rc.env) > 0 {
+		var exports []string
+		for _, elt := range rc.env {
+			key, value, _ := strings.Cut(elt, "=")
+			exports = append(exports, fmt.Sprintf("%s=%s", key, shellQuote(value)))
+		}
+		s = fmt.Sprintf("export %s; %s", strings.Join(exports, " "), s)
+	}
+	if rc.user != "" {
+		s = fmt.Sprintf("sudo -n -H -u %s -- sh -c %s", shellQuote(rc.user), shellQuote(s))
+	}
+	return s
+}
+
+// Run executes the command and waits for its end. Result is never nil, even if an error is returned.
+// Cancelling ctx sends SIGTERM to the remote process, then SIGKILL if it is still alive after killDelay.
+// In dry run, the command is only planned, unless it is ReadOnly.
+func (rc *RemoteCommand) Run(ctx context.Context) (*RemoteResult, *cmd.XbeeError) {
+	if cmd.IsDryRun(ctx) && !rc.readOnly {
+		cmd.Plan(ctx, "run %s on %s", rc.command, rc.prefix)
+		return &RemoteResult{}, nil
+	}
+	if ctx == nil {
+		ctx = cmd.Context()
+	}
+	if rc.retry == nil {
+		return rc.run(ctx)
+	}
+	var result *RemoteResult
+	err := rc.retry.Do(ctx, fmt.Sprintf("[%s] on %s", rc.command, rc.prefix), func(ctx context.Context) (int, string, *cmd.XbeeError) {
+		var err *cmd.XbeeError
+		result, err = rc.run(ctx)
+		return result.ExitStatus, result.Stderr, err
+	})
+	return result, err
+}
+
+func (rc *RemoteCommand) run(ctx context.Context) (*RemoteResult, *cmd.XbeeError) {
+	result := &RemoteResult{ExitStatus: -1}
+	sess, err := rc.client.NewSession()
+	if err != nil {
+		return result, cmd.Error("cannot create session : %v", err)
+	}
+	defer func() {
+		if err3 := sess.Close(); err3 != nil && err3 != io.EOF {
+			log2.Debugf("An error occurred when closing session : %v", err3)
+		}
+	}()
+	if rc.pty {
+		if err := sess.RequestPty(termName(), 40, 80, ssh.TerminalModes{ssh.ECHO: 0}); err != nil {
+			return result, cmd.Error("cannot request pty on %s : %v", rc.prefix, err)
+		}
+	}
+
+	bOut, bErr := &bytes.Buffer{}, &bytes.Buffer{}
+	sess.Stdout, sess.Stderr = bOut, bErr
+	if !rc.quiet {
+		outLogger := exec2.NewLineWriter().WithPrefix(rc.prefix).ToLog(log2.Infof)
+		errLogger := exec2.NewLineWriter().WithPrefix(rc.prefix).ToLog(log2.Infof)
+		defer outLogger.Flush()
+		defer errLogger.Flush()
+		sess.Stdout = io.MultiWriter(bOut, outLogger)
+		sess.Stderr = io.MultiWriter(bErr, errLogger)
+	}
+	sess.Stdin = rc.stdin
+
+	command := rc.String()
+	if err := sess.Start(command); err != nil {
+		return result, cmd.Error("cannot start command [%s] on %s : %v", command, rc.prefix, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.Wait()
+	}()
+	var errWait, interrupted error
+	select {
+	case errWait = <-done:
+	case <-ctx.Done():
+		interrupted = ctx.Err()
+		errWait = interrupt(sess, done, rc.prefix)
+	}
+
+	result.Stdout, result.Stderr = bOut.String(), bErr.String()
+	switch e := errWait.(type) {
+	case nil:
+		result.ExitStatus = 0
+	case *ssh.ExitError:
+		result.ExitStatus = e.ExitStatus()
+		result.Signal = e.Signal()
+	}
+	if interrupted != nil {
+		return result, cmd.Error("command [%s] on %s interrupted : %v", rc.command, rc.prefix, interrupted)
+	}
+	if errWait != nil {
+		return result, cmd.RemoteError("command [%s] on %s failed : %v\n%s", rc.command, rc.prefix, errWait, strings.TrimSpace(result.Stderr)).
+			WithHost(rc.prefix).WithCommand(rc.command)
+	}
+	return result, nil
+}
+
+func interrupt(sess *ssh.Session, done <-chan error, prefix string) error {
+	log2.Warnf("Interrupting remote command on %s", prefix)
+	if err := sess.Signal(ssh.SIGTERM); err != nil {
+		log2.Debugf("cannot send SIGTERM to %s : %v", prefix, err)
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(killDelay):
+	}
+	if err := sess.Signal(ssh.SIGKILL); err != nil {
+		log2.Debugf("cannot send SIGKILL to %s : %v", prefix, err)
+	}
+	if err := sess.Close(); err != nil && err != io.EOF {
+		log2.Debugf("An error occurred when closing session : %v", err)
+	}
+	return <-done
+}
+
+func termName() string {
+	if term := os.Getenv("TERM"); term != "" {
+		return term
+	}
+	return "xterm"
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,199 @@
+package ssh2
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/log2"
+	"github.com/iodasolutions/xbee-common/newfs"
+	"github.com/iodasolutions/xbee-common/stringutils"
+	"github.com/iodasolutions/xbee-common/template"
+)
+
+// RemoteFile ensures the content, owner and mode of a file on the remote host. The file is uploaded only if it differs.
+type RemoteFile struct {
+	client *SSHClient
+	path   newfs.File
+
+	owner  string
+	mode   os.FileMode
+	backup bool
+	dryRun bool
+}
+
+// EnsureResult reports what was (or would be, in dry run) done on a remote file.
+// Diff is only computed in dry run.
+type EnsureResult struct {
+	Path    string
+	Changed bool
+	Backup  string
+	Diff    string
+}
+
+func (hr *SSHClient) EnsureFile(path newfs.File) *RemoteFile {
+	return &RemoteFile{
+		client: hr,
+		path:   path,
+	}
+}
+
+// WithOwner sets owner, in the chown form user[:group].
+func (rf *RemoteFile) WithOwner(owner string) *RemoteFile {
+	rf.owner = owner
+	return rf
+}
+func (rf *RemoteFile) WithMode(mode os.FileMode) *RemoteFile {
+	rf.mode = mode
+	return rf
+}
+
+// WithBackup keeps a copy of the previous version, suffixed with a timestamp, before replacing it.
+func (rf *RemoteFile) WithBackup() *RemoteFile {
+	rf.backup = true
+	return rf
+}
+
+// DryRun computes changes and their diff without applying them. It is the default with the --dry-run option.
+func (rf *RemoteFile) DryRun() *RemoteFile {
+	rf.dryRun = true
+	return rf
+}
+
+// Template renders templateS with the template package, and ensures the remote file has the result as content.
+func (rf *RemoteFile) Template(ctx context.Context, templateS string, data interface{}, funcMap map[string]interface{}) (*EnsureResult, *cmd.XbeeError) {
+	content := templateS
+	if err := template.Output(&content, data, funcMap); err != nil {
+		return nil, err
+	}
+	return rf.Content(ctx, content)
+}
+
+// Section ensures the XBEE AREA of the remote file has section as content, leaving the rest of the file untouched.
+// The area is appended if the file has none.
+func (rf *RemoteFile) Section(ctx context.Context, section string) (*EnsureResult, *cmd.XbeeError) {
+	current, _, err := rf.client.ReadFile(ctx, rf.path)
+	if err != nil {
+		return nil, err
+	}
+	_, other, index, err := stringutils.ExtractSection(current)
+	if err != nil {
+		return nil, err
+	}
+	return rf.Content(ctx, stringutils.InsertSection(other, section, index))
+}
+
+func (rf *RemoteFile) Content(ctx context.Context, content string) (*EnsureResult, *cmd.XbeeError) {
+	result := &EnsureResult{Path: rf.path.String()}
+	state, err := rf.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	contentChanged := state.sha1 != stringutils.Sha1String(content)
+	result.Changed = contentChanged ||
+		(rf.owner != "" && !sameOwner(state.owner, rf.owner)) ||
+		(rf.mode != 0 && state.mode != fmt.Sprintf("%o", rf.mode.Perm()))
+	if !result.Changed {
+		log2.Debugf("%s on %s unchanged", rf.path, rf.client.RemoteAddr())
+		return result, nil
+	}
+	if dryRun := cmd.IsDryRun(ctx); dryRun || rf.dryRun {
+		if contentChanged {
+			current, _, err := rf.client.ReadFile(ctx, rf.path)
+			if err != nil {
+				return nil, err
+			}
+			result.Diff = fmt.Sprintf("--- %s (remote)\n+++ %s (expected)\n%s", rf.path, rf.path, stringutils.Diff(current, content))
+		}
+		if dryRun {
+			cmd.Plan(ctx, "change %s on %s\n%s", rf.path, rf.client.RemoteAddr(), result.Diff)
+		} else {
+			log2.Infof("%s on %s would be changed", rf.path, rf.client.RemoteAddr())
+		}
+		return result, nil
+	}
+
+	if contentChanged {
+		if rf.backup && state.exists {
+			result.Backup = fmt.Sprintf("%s.%s", rf.path, time.Now().Format("20060102-150405"))
+			if err := rf.run(ctx, fmt.Sprintf("sudo cp -p %s %s", shellQuote(rf.path.String()), shellQuote(result.Backup))); err != nil {
+				return nil, err
+			}
+		}
+		if err := rf.client.UploadContentContext(ctx, content, rf.path); err != nil {
+			return nil, err
+		}
+	}
+	if rf.owner != "" {
+		if err := rf.run(ctx, fmt.Sprintf("sudo chown %s %s", shellQuote(rf.owner), shellQuote(rf.path.String()))); err != nil {
+			return nil, err
+		}
+	}
+	if rf.mode != 0 {
+		if err := rf.run(ctx, fmt.Sprintf("sudo chmod %o %s", rf.mode.Perm(), shellQuote(rf.path.String()))); err != nil {
+			return nil, err
+		}
+	}
+	log2.Infof("%s on %s changed", rf.path, rf.client.RemoteAddr())
+	return result, nil
+}
+
+type remoteFileState struct {
+	exists bool
+	sha1   string
+	owner  string
+	mode   string
+}
+
+// state reads the sha1, mode and owner of the remote file. Outputs do not contain the path, which may have spaces.
+func (rf *RemoteFile) state(ctx context.Context) (*remoteFileState, *cmd.XbeeError) {
+	path := shellQuote(rf.path.String())
+	script := fmt.Sprintf("if [ -f %s ]; then sha1sum < %s; stat -c '%%a %%U:%%G' %s; fi", path, path, path)
+	result, err := rf.client.NewCommand("sudo sh -c " + shellQuote(script)).Quiet().ReadOnly().Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	if len(lines) < 2 {
+		return &remoteFileState{}, nil
+	}
+	sha1, _, _ := strings.Cut(lines[0], " ")
+	mode, owner, _ := strings.Cut(lines[1], " ")
+	return &remoteFileState{
+		exists: true,
+		sha1:   sha1,
+		owner:  owner,
+		mode:   mode,
+	}, nil
+}
+
+func (rf *RemoteFile) run(ctx context.Context, command string) *cmd.XbeeError {
+	_, err := rf.client.NewCommand(command).Quiet().Run(ctx)
+	return err
+}
+
+// sameOwner compares an actual user:group with an expected user[:group].
+func sameOwner(actual string, expected string) bool {
+	if strings.Contains(expected, ":") {
+		return actual == expected
+	}
+	user, _, _ := strings.Cut(actual, ":")
+	return user == expected
+}
+
+// ReadFile returns the content of a remote file, read with sudo. exists is false if the file does not exist.
+func (hr *SSHClient) ReadFile(ctx context.Context, path newfs.File) (content string, exists bool, err *cmd.XbeeError) {
+	quoted := shellQuote(path.String())
+	script := fmt.Sprintf("if [ -f %s ]; then echo exists; cat %s; fi", quoted, quoted)
+	result, err := hr.NewCommand("sudo sh -c " + shellQuote(script)).Quiet().ReadOnly().Run(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	if marker, rest, ok := strings.Cut(result.Stdout, "\n"); ok && marker == "exists" {
+		return rest, true, nil
+	}
+	return "", false, nil
+}
@@ -0,0 +1,189 @@
+package ssh2
+
+import (
+	"bufio"
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+)
+
+// Facts describes the remote host. Arch uses go naming (amd64, arm64), as expected by the template mapArch function.
+type Facts struct {
+	OS               OsRelease
+	Kernel           string
+	Machine          string // raw uname -m
+	Arch             string
+	CPUs             int
+	MemoryBytes      int64
+	Disks            []Disk
+	Interfaces       []NetInterface
+	InitSystem       string
+	PackageManager   string
+	PasswordlessSudo bool
+}
+
+type OsRelease struct {
+	ID         string
+	IDLike     string
+	VersionID  string
+	PrettyName string
+}
+
+type Disk struct {
+	Name      string
+	SizeBytes int64
+}
+
+type NetInterface struct {
+	Name      string
+	Addresses []string // CIDR notation
+}
+
+const factsScript = `echo '## os'; cat /etc/os-release 2>/dev/null
+echo '## kernel'; uname -r
+echo '## machine'; uname -m
+echo '## cpus'; nproc 2>/dev/null || getconf _NPROCESSORS_ONLN
+echo '## memory'; grep MemTotal /proc/meminfo
+echo '## disks'; lsblk -b -d -n -o NAME,SIZE,TYPE 2>/dev/null
+echo '## interfaces'; ip -o addr show 2>/dev/null
+echo '## init'; cat /proc/1/comm 2>/dev/null
+echo '## packages'; for pm in apt-get dnf yum apk zypper pacman; do command -v $pm >/dev/null 2>&1 && echo $pm && break; done
+echo '## sudo'; sudo -n true >/dev/null 2>&1 && echo yes || echo no
+`
+
+// Facts gathers facts on the remote host. They are computed once per connection.
+func (hr *SSHClient) Facts(ctx context.Context) (*Facts, *cmd.XbeeError) {
+	hr.factsLock.Lock()
+	defer hr.factsLock.Unlock()
+	if hr.facts != nil {
+		return hr.facts, nil
+	}
+	result, err := hr.NewCommand("sh -c " + shellQuote(factsScript)).Quiet().ReadOnly().Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hr.facts = parseFacts(splitSections(result.Stdout))
+	return hr.facts, nil
+}
+
+// TemplateData exposes facts to templates, for instance {{ .arch | mapArch }}.
+func (f *Facts) TemplateData() map[string]interface{} {
+	return map[string]interface{}{
+		"os":               f.OS.ID,
+		"oslike":           f.OS.IDLike,
+		"osversion":        f.OS.VersionID,
+		"kernel":           f.Kernel,
+		"arch":             f.Arch,
+		"cpus":             f.CPUs,
+		"memory":           f.MemoryBytes,
+		"initsystem":       f.InitSystem,
+		"packagemanager":   f.PackageManager,
+		"passwordlesssudo": f.PasswordlessSudo,
+	}
+}
+
+// CheckOsArch returns an error if osArch, in the form os_arch or os/arch, does not match the host.
+func (f *Facts) CheckOsArch(osArch string) *cmd.XbeeError {
+	goos, arch, ok := strings.Cut(strings.ReplaceAll(osArch, "/", "_"), "_")
+	if !ok {
+		return cmd.Error("osarch %s MUST have format os_arch", osArch)
+	}
+	if goos != "linux" || arch != f.Arch {
+		return cmd.Error("osarch %s does not match host, actual is linux_%s", osArch, f.Arch)
+	}
+	return nil
+}
+
+func splitSections(out string) map[string][]string {
+	sections := map[string][]string{}
+	var current string
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if name, ok := strings.CutPrefix(line, "## "); ok {
+			current = name
+		} else if line != "" {
+			sections[current] = append(sections[current], line)
+		}
+	}
+	return sections
+}
+
+func parseFacts(sections map[string][]string) *Facts {
+	first := func(name string) string {
+		if lines := sections[name]; len(lines) > 0 {
+			return lines[0]
+		}
+		return ""
+	}
+	f := &Facts{
+		Kernel:           first("kernel"),
+		Machine:          first("machine"),
+		PasswordlessSudo: first("sudo") == "yes",
+	}
+	f.Arch = goArch(f.Machine)
+	f.CPUs, _ = strconv.Atoi(first("cpus"))
+	if fields := strings.Fields(first("memory")); len(fields) >= 2 {
+		kb, _ := strconv.ParseInt(fields[1], 10, 64)
+		f.MemoryBytes = kb * 1024
+	}
+	for _, line := range sections["os"] {
+		key, value, _ := strings.Cut(line, "=")
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			f.OS.ID = value
+		case "ID_LIKE":
+			f.OS.IDLike = value
+		case "VERSION_ID":
+			f.OS.VersionID = value
+		case "PRETTY_NAME":
+			f.OS.PrettyName = value
+		}
+	}
+	for _, line := range sections["disks"] {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[2] == "disk" {
+			size, _ := strconv.ParseInt(fields[1], 10, 64)
+			f.Disks = append(f.Disks, Disk{Name: fields[0], SizeBytes: size})
+		}
+	}
+	for _, line := range sections["interfaces"] {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || (fields[2] != "inet" && fields[2] != "inet6") {
+			continue
+		}
+		name := strings.TrimSuffix(fields[1], ":")
+		if len(f.Interfaces) == 0 || f.Interfaces[len(f.Interfaces)-1].Name != name {
+			f.Interfaces = append(f.Interfaces, NetInterface{Name: name})
+		}
+		last := &f.Interfaces[len(f.Interfaces)-1]
+		last.Addresses = append(last.Addresses, fields[3])
+	}
+	switch init := first("init"); init {
+	case "init":
+		f.InitSystem = "sysvinit"
+	case "openrc-init":
+		f.InitSystem = "openrc"
+	default:
+		f.InitSystem = init
+	}
+	f.PackageManager = strings.TrimSuffix(first("packages"), "-get")
+	return f
+}
+
+func goArch(machine string) string {
+	switch machine {
+	case "x86_64", "amd64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
+	case "i386", "i686":
+		return "386"
+	case "armv7l", "armv6l":
+		return "arm"
+	}
+	return machine
+}
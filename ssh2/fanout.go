@@ -0,0 +1,271 @@
+package ssh2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/newfs"
+	"github.com/iodasolutions/xbee-common/provider"
+	"github.com/iodasolutions/xbee-common/stringutils"
+)
+
+const defaultConcurrency = 10
+
+func ParallelOption() *cmd.Option {
+	return cmd.NewIntOption("parallel", "", defaultConcurrency).WithDescription("Maximum number of hosts processed at the same time")
+}
+func BatchOption() *cmd.Option {
+	return cmd.NewIntOption("batch", "", 0).WithDescription("Process hosts in rolling batches of this size, 0 for a single batch")
+}
+func FailFastOption() *cmd.Option {
+	return cmd.NewBooleanOption("fail-fast", "", false).WithDescription("Stop at the first host in error")
+}
+func CanaryOption() *cmd.Option {
+	return cmd.NewOption("canary", "", "").WithDescription("Host processed alone first, others are skipped if it fails")
+}
+
+// FanOutOptions returns the options read by NewFanOutFromOptions, to be added to a command.
+func FanOutOptions() []*cmd.Option {
+	return []*cmd.Option{ParallelOption(), BatchOption(), FailFastOption(), CanaryOption()}
+}
+
+// FanOut runs the same command or script on many hosts.
+type FanOut struct {
+	hosts       provider.InstanceInfos
+	concurrency int
+	batch       int
+	failFast    bool
+	canary      string
+	keys        *newfs.RsaGenerator
+}
+
+func NewFanOut(hosts provider.InstanceInfos) *FanOut {
+	return &FanOut{
+		hosts:       hosts,
+		concurrency: defaultConcurrency,
+		keys:        newfs.NewRsaGen(newfs.NewFolder("")),
+	}
+}
+
+// NewFanOutFromOptions configures a FanOut from the options returned by FanOutOptions, parsed for the command
+// run with ctx.
+func NewFanOutFromOptions(ctx context.Context, hosts provider.InstanceInfos) (*FanOut, *cmd.XbeeError) {
+	fo := NewFanOut(hosts)
+	options := cmd.OptionsFrom(ctx)
+	if options.Has("parallel") {
+		if fo.concurrency = options.Get("parallel").IntValue(); fo.concurrency < 1 {
+			return nil, cmd.UsageError("option --parallel MUST be a positive integer, actual is %d", fo.concurrency)
+		}
+	}
+	if options.Has("batch") {
+		if fo.batch = options.Get("batch").IntValue(); fo.batch < 0 {
+			return nil, cmd.UsageError("option --batch MUST not be negative, actual is %d", fo.batch)
+		}
+	}
+	if options.Has("fail-fast") {
+		fo.failFast = options.Get("fail-fast").BooleanValue()
+	}
+	if options.Has("canary") {
+		fo.canary = options.Get("canary").StringValue()
+	}
+	return fo, nil
+}
+
+func (fo *FanOut) WithConcurrency(n int) *FanOut {
+	if n > 0 {
+		fo.concurrency = n
+	}
+	return fo
+}
+
+// WithBatch processes hosts by batches of n hosts, waiting for a batch to end before starting the next one.
+func (fo *FanOut) WithBatch(n int) *FanOut {
+	fo.batch = n
+	return fo
+}
+func (fo *FanOut) FailFast() *FanOut {
+	fo.failFast = true
+	return fo
+}
+func (fo *FanOut) WithCanary(name string) *FanOut {
+	fo.canary = name
+	return fo
+}
+
+// WithKeys authenticates with the xbee key of rg, see ConnectWith.
+func (fo *FanOut) WithKeys(rg *newfs.RsaGenerator) *FanOut {
+	fo.keys = rg
+	return fo
+}
+
+type HostResult struct {
+	Host     string
+	Result   *RemoteResult
+	Err      *cmd.XbeeError
+	Skipped  bool
+	Duration time.Duration
+}
+
+type HostResults []*HostResult
+
+// Err returns an error caused by the errors of all failed hosts, or nil.
+func (hrs HostResults) Err() *cmd.XbeeError {
+	var errs []*cmd.XbeeError
+	for _, hr := range hrs {
+		if hr.Err != nil {
+			errs = append(errs, hr.Err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return cmd.CauseBy(errs...)
+}
+
+func (hrs HostResults) String() string {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSTATUS\tEXIT\tDURATION")
+	for _, hr := range hrs {
+		status, exit := "ok", "-"
+		switch {
+		case hr.Skipped:
+			status = "skipped"
+		case hr.Err != nil:
+			status = "failed"
+		}
+		if hr.Result != nil && hr.Result.ExitStatus != -1 {
+			exit = strconv.Itoa(hr.Result.ExitStatus)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", hr.Host, status, exit, hr.Duration.Round(time.Millisecond))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// hostFunc runs on a host. In dry run, hosts are not connected and client is nil.
+type hostFunc func(ctx context.Context, client *SSHClient, info *provider.InstanceInfo) (*RemoteResult, *cmd.XbeeError)
+
+func (fo *FanOut) RunCommand(ctx context.Context, command string) (HostResults, *cmd.XbeeError) {
+	return fo.run(ctx, func(ctx context.Context, client *SSHClient, info *provider.InstanceInfo) (*RemoteResult, *cmd.XbeeError) {
+		if cmd.IsDryRun(ctx) {
+			cmd.Plan(ctx, "run %s on %s", command, info.Name)
+			return &RemoteResult{}, nil
+		}
+		return client.NewCommand(command).WithPrefix(info.Name).Run(ctx)
+	})
+}
+
+// RunScript uploads script on each host and runs it with sudo bash, as SSHClient.RunScript does.
+func (fo *FanOut) RunScript(ctx context.Context, script string) (HostResults, *cmd.XbeeError) {
+	return fo.run(ctx, func(ctx context.Context, client *SSHClient, info *provider.InstanceInfo) (*RemoteResult, *cmd.XbeeError) {
+		if cmd.IsDryRun(ctx) {
+			cmd.Plan(ctx, "run script on %s :\n%s", info.Name, script)
+			return &RemoteResult{}, nil
+		}
+		f := newfs.NewFolder("/tmp").ChildFile(stringutils.RandomString())
+		if err := client.UploadContentContext(ctx, script, f); err != nil {
+			return nil, err
+		}
+		command := fmt.Sprintf("sudo bash %s; status=$?; sudo rm -f %s; exit $status", f, f)
+		return client.NewCommand(command).WithPrefix(info.Name).Run(ctx)
+	})
+}
+
+func (fo *FanOut) run(ctx context.Context, f hostFunc) (HostResults, *cmd.XbeeError) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var results HostResults
+	hosts := fo.hosts
+	if fo.canary != "" {
+		var canary *provider.InstanceInfo
+		hosts = nil
+		for _, info := range fo.hosts {
+			if info.Name == fo.canary {
+				canary = info
+			} else {
+				hosts = append(hosts, info)
+			}
+		}
+		if canary == nil {
+			return nil, cmd.NotFoundError("canary host %s is not among hosts", fo.canary)
+		}
+		result := fo.runOn(ctx, canary, f)
+		results = append(results, result)
+		if result.Err != nil {
+			return append(results, skipped(hosts)...), results.Err()
+		}
+	}
+	for len(hosts) > 0 {
+		size := len(hosts)
+		if fo.batch > 0 && fo.batch < size {
+			size = fo.batch
+		}
+		batchResults := fo.runBatch(ctx, cancel, hosts[:size], f)
+		results = append(results, batchResults...)
+		hosts = hosts[size:]
+		if fo.failFast && batchResults.Err() != nil {
+			results = append(results, skipped(hosts)...)
+			break
+		}
+	}
+	return results, results.Err()
+}
+
+func (fo *FanOut) runBatch(ctx context.Context, cancel context.CancelFunc, hosts provider.InstanceInfos, f hostFunc) HostResults {
+	results := make(HostResults, len(hosts))
+	sem := make(chan bool, fo.concurrency)
+	var wg sync.WaitGroup
+	wg.Add(len(hosts))
+	for i, info := range hosts {
+		go func(i int, info *provider.InstanceInfo) {
+			defer wg.Done()
+			sem <- true
+			defer func() { <-sem }()
+			if fo.failFast && ctx.Err() != nil {
+				results[i] = &HostResult{Host: info.Name, Skipped: true}
+				return
+			}
+			results[i] = fo.runOn(ctx, info, f)
+			if fo.failFast && results[i].Err != nil {
+				cancel()
+			}
+		}(i, info)
+	}
+	wg.Wait()
+	return results
+}
+
+func (fo *FanOut) runOn(ctx context.Context, info *provider.InstanceInfo, f hostFunc) *HostResult {
+	start := time.Now()
+	result := &HostResult{Host: info.Name}
+	if cmd.IsDryRun(ctx) {
+		result.Result, result.Err = f(ctx, nil, info)
+		return result
+	}
+	port := info.SSHPort
+	if port == "" {
+		port = "22"
+	}
+	client, err := ConnectWith(info.ExternalIp, port, info.User, fo.keys)
+	if err == nil {
+		defer client.Close()
+		result.Result, err = f(ctx, client, info)
+	}
+	result.Err = err
+	result.Duration = time.Since(start)
+	return result
+}
+
+func skipped(hosts provider.InstanceInfos) (result HostResults) {
+	for _, info := range hosts {
+		result = append(result, &HostResult{Host: info.Name, Skipped: true})
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package ssh2
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/log2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// Shell opens an interactive login shell on the remote host, bound to the local terminal.
+// Cancelling ctx closes the session.
+func (hr *SSHClient) Shell(ctx context.Context) *cmd.XbeeError {
+	return hr.interactive(ctx, "")
+}
+
+// RunInteractive runs command with a PTY bound to the local terminal, so that programs like vim, top or sudo prompts work.
+func (hr *SSHClient) RunInteractive(command string) *cmd.XbeeError {
+	return hr.interactive(context.Background(), command)
+}
+
+func (hr *SSHClient) interactive(ctx context.Context, command string) *cmd.XbeeError {
+	sess, err := hr.NewSession()
+	if err != nil {
+		return cmd.Error("cannot create session : %v", err)
+	}
+	defer func() {
+		if err3 := sess.Close(); err3 != nil && err3 != io.EOF {
+			log2.Debugf("An error occurred when closing session : %v", err3)
+		}
+	}()
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return cmd.Error("cannot put terminal in raw mode : %v", err)
+		}
+		defer func() {
+			if err := term.Restore(fd, state); err != nil {
+				log2.Warnf("cannot restore terminal : %v", err)
+			}
+		}()
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := sess.RequestPty(termName(), height, width, modes); err != nil {
+			return cmd.Error("cannot request pty on %s : %v", hr.RemoteAddr(), err)
+		}
+		stop := watchResize(sess, fd)
+		defer stop()
+	}
+	sess.Stdin = os.Stdin
+	sess.Stdout = os.Stdout
+	sess.Stderr = os.Stderr
+
+	if command == "" {
+		err = sess.Shell()
+	} else {
+		err = sess.Start(command)
+	}
+	if err != nil {
+		return cmd.Error("cannot start interactive session on %s : %v", hr.RemoteAddr(), err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		return cmd.Error("interactive session on %s interrupted : %v", hr.RemoteAddr(), ctx.Err())
+	}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return cmd.Error("interactive session on %s exited with status %d", hr.RemoteAddr(), exitErr.ExitStatus())
+	} else if err != nil {
+		return cmd.Error("interactive session on %s failed : %v", hr.RemoteAddr(), err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package ssh2
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// watchResize forwards local terminal resizes (SIGWINCH) to the remote PTY, until the returned func is called.
+func watchResize(sess *ssh.Session, fd int) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+	go func() {
+		for range ch {
+			if width, height, err := term.GetSize(fd); err == nil {
+				_ = sess.WindowChange(height, width)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,10 @@
+package ssh2
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+// watchResize does nothing : windows consoles do not notify resizes with a signal.
+func watchResize(_ *ssh.Session, _ int) func() {
+	return func() {}
+}
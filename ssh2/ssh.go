@@ -1,6 +1,8 @@
 package ssh2
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"github.com/iodasolutions/xbee-common/cmd"
 	"github.com/iodasolutions/xbee-common/exec2"
@@ -10,15 +12,23 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 )
 
 type SSHClient struct {
 	*ssh.Client
+
+	factsLock sync.Mutex
+	facts     *Facts
 }
 
 func Connect(host string, port string, user string) (*SSHClient, *cmd.XbeeError) {
+	return ConnectWith(host, port, user, newfs.NewRsaGen(newfs.NewFolder("")))
+}
+
+// ConnectWith authenticates with the xbee key of rg, instead of the one from the global xbee folder.
+func ConnectWith(host string, port string, user string, rg *newfs.RsaGenerator) (*SSHClient, *cmd.XbeeError) {
 	var aConf *ssh.ClientConfig
-	rg := newfs.NewRsaGen(newfs.NewFolder(""))
 	xbeeKey := rg.RootKeyPEM().Content()
 	pemBytes := []byte(xbeeKey)
 	signer, err := ssh.ParsePrivateKey(pemBytes)
@@ -35,7 +45,7 @@ func Connect(host string, port string, user string) (*SSHClient, *cmd.XbeeError)
 	var conn *ssh.Client
 	conn, err = ssh.Dial("tcp", connexionString, aConf)
 	if err != nil {
-		return nil, cmd.Error("ssh : cannot connect to %s with user %s : %v", connexionString, user, err)
+		return nil, cmd.RemoteError("ssh : cannot connect to %s with user %s : %v", connexionString, user, err)
 	}
 	var aSession *ssh.Session
 	if aSession, err = conn.NewSession(); err == nil {
@@ -49,7 +59,7 @@ func Connect(host string, port string, user string) (*SSHClient, *cmd.XbeeError)
 	} else {
 		return nil, cmd.Error("ssh : cannot create session to %s : %v", connexionString, err)
 	}
-	return &SSHClient{conn}, nil
+	return &SSHClient{Client: conn}, nil
 }
 
 func (hr *SSHClient) RunCommand(command string) *cmd.XbeeError {
@@ -108,15 +118,29 @@ func (hr *SSHClient) run(command string, redirectStd bool) (err *cmd.XbeeError)
 }
 
 func (hr *SSHClient) RunScript(script string) *cmd.XbeeError {
-	return hr.runScript(script, true)
+	return hr.RunScriptContext(nil, script)
+}
+
+// RunScriptContext is RunScript, the dry run setting being the one of the command run with ctx.
+func (hr *SSHClient) RunScriptContext(ctx context.Context, script string) *cmd.XbeeError {
+	return hr.runScript(ctx, script, true)
 }
 func (hr *SSHClient) RunScriptQuiet(script string) *cmd.XbeeError {
-	return hr.runScript(script, false)
+	return hr.RunScriptQuietContext(nil, script)
+}
+
+// RunScriptQuietContext is RunScriptQuiet, the dry run setting being the one of the command run with ctx.
+func (hr *SSHClient) RunScriptQuietContext(ctx context.Context, script string) *cmd.XbeeError {
+	return hr.runScript(ctx, script, false)
 }
-func (hr *SSHClient) runScript(script string, redirectStd bool) (err *cmd.XbeeError) {
+func (hr *SSHClient) runScript(ctx context.Context, script string, redirectStd bool) (err *cmd.XbeeError) {
+	if cmd.IsDryRun(ctx) {
+		cmd.Plan(ctx, "run script on %s :\n%s", hr.RemoteAddr(), script)
+		return nil
+	}
 	f := newfs.TmpDir().RandomFile()
 	defer func() {
-		err2 := f.EnsureDelete()
+		err2 := f.DeleteTemp()
 		if err2 != nil {
 			if err == nil {
 				err = err2
@@ -126,7 +150,7 @@ func (hr *SSHClient) runScript(script string, redirectStd bool) (err *cmd.XbeeEr
 		}
 	}()
 	f.SetContent(script)
-	err = hr.UploadFile(f, newfs.NewFolder("/tmp"))
+	err = hr.UploadFileContext(ctx, f, newfs.NewFolder("/tmp"))
 	if err != nil {
 		return
 	}
@@ -135,6 +159,11 @@ func (hr *SSHClient) runScript(script string, redirectStd bool) (err *cmd.XbeeEr
 }
 
 func (hr *SSHClient) UploadFile(path newfs.File, todir newfs.Folder) (err *cmd.XbeeError) {
+	return hr.UploadFileContext(nil, path, todir)
+}
+
+// UploadFileContext is UploadFile, the dry run setting being the one of the command run with ctx.
+func (hr *SSHClient) UploadFileContext(ctx context.Context, path newfs.File, todir newfs.Folder) (err *cmd.XbeeError) {
 	fileInfo, err2 := os.Stat(path.String())
 	if err2 != nil {
 		err = cmd.Error("cannot stat %s : %v", path, err2)
@@ -144,25 +173,30 @@ func (hr *SSHClient) UploadFile(path newfs.File, todir newfs.Folder) (err *cmd.X
 	file, err2 = os.Open(path.String())
 	if err2 != nil {
 		err = cmd.Error("cannot open %s : %v", path, err2)
+		return
 	}
 	defer func() {
 		if file != nil {
-			if err4 := file.Close(); err != nil {
-				err = cmd.Error("cannot close f %s: %v", file, err4)
+			if err4 := file.Close(); err4 != nil {
+				err = cmd.Error("cannot close f %s: %v", path, err4)
 			}
 		}
 	}()
 	length := fileInfo.Size()
-	return hr.upload(file, length, path.Base(), todir)
+	return hr.upload(ctx, file, length, path.Base(), todir)
 }
 
-func (hr *SSHClient) upload(r io.Reader, length int64, name string, todir newfs.Folder) (err *cmd.XbeeError) {
+func (hr *SSHClient) upload(ctx context.Context, r io.Reader, length int64, name string, todir newfs.Folder) (err *cmd.XbeeError) {
+	if cmd.IsDryRun(ctx) {
+		cmd.Plan(ctx, "upload %s (%d bytes) to %s on %s", name, length, todir, hr.RemoteAddr())
+		return nil
+	}
 	if err = hr.RunCommandQuiet(fmt.Sprintf("sudo mkdir -p %s", todir)); err != nil {
 		return
 	}
 	sess, err2 := hr.NewSession()
 	if err2 != nil {
-		err = cmd.Error("cannot create a session for connection %s: %v", hr.RemoteAddr().String(), err)
+		err = cmd.Error("cannot create a session for connection %s: %v", hr.RemoteAddr().String(), err2)
 		return
 	}
 	defer func() {
@@ -172,20 +206,27 @@ func (hr *SSHClient) upload(r io.Reader, length int64, name string, todir newfs.
 			}
 		}
 	}()
+	w, err2 := sess.StdinPipe()
+	if err2 != nil {
+		err = cmd.Error("cannot get stdin for session [%s]: %v", hr.RemoteAddr().String(), err2)
+		return
+	}
+	errCh := make(chan *cmd.XbeeError, 1)
 	go func() {
-		w, _ := sess.StdinPipe()
+		var err4 *cmd.XbeeError
 		defer func() {
-			if err2 := w.Close(); err2 != nil {
-				err = cmd.Error("cannot close writer: %v", err)
+			if err2 := w.Close(); err2 != nil && err4 == nil {
+				err4 = cmd.Error("cannot close writer: %v", err2)
 			}
+			errCh <- err4
 		}()
 		if _, err5 := fmt.Fprintln(w, "C0644", length, name); err5 != nil {
-			err = cmd.Error("unexpected error : %v", err5)
+			err4 = cmd.Error("unexpected error : %v", err5)
 			return
 		}
-		_, err6 := io.Copy(w, r)
-		if err6 != nil {
-			err = cmd.Error("unexpected error : %v", err6)
+		if _, err6 := io.Copy(w, r); err6 != nil {
+			err4 = cmd.Error("unexpected error : %v", err6)
+			return
 		}
 		if _, err2 := fmt.Fprint(w, "\x00"); err2 != nil {
 			return
@@ -194,15 +235,23 @@ func (hr *SSHClient) upload(r io.Reader, length int64, name string, todir newfs.
 	}()
 	command := fmt.Sprintf("sudo /usr/bin/scp -tr %s", todir)
 	if err2 = sess.Run(command); err2 != nil {
-		err = cmd.Error("command [%s] for session [%s] failed: %v", command, hr.RemoteAddr().String(), err)
+		err = cmd.Error("command [%s] for session [%s] failed: %v", command, hr.RemoteAddr().String(), err2)
+	}
+	if err4 := <-errCh; err == nil {
+		err = err4
 	}
 	return
 }
 
 func (hr *SSHClient) UploadContent(content string, path newfs.File) (err *cmd.XbeeError) {
+	return hr.UploadContentContext(nil, content, path)
+}
+
+// UploadContentContext is UploadContent, the dry run setting being the one of the command run with ctx.
+func (hr *SSHClient) UploadContentContext(ctx context.Context, content string, path newfs.File) (err *cmd.XbeeError) {
 	r := strings.NewReader(content)
 	length := int64(len(content))
-	return hr.upload(r, length, path.Base(), path.Dir())
+	return hr.upload(ctx, r, length, path.Base(), path.Dir())
 }
 
 func (hr *SSHClient) Download(remoteFile newfs.File, todir newfs.Folder) (err *cmd.XbeeError) {
@@ -227,49 +276,64 @@ func (hr *SSHClient) Download(remoteFile newfs.File, todir newfs.Folder) (err *c
 	}
 	defer f.Close()
 
-	go func() {
-		r, _ := sess.StdoutPipe()
-		if err4 := downloadInternScp(r, f); err4 != nil {
-			err = err4
-		}
-	}()
-
+	w, err2 := sess.StdinPipe()
+	if err2 != nil {
+		return cmd.Error("cannot get stdin for session: %v", err2)
+	}
+	r, err2 := sess.StdoutPipe()
+	if err2 != nil {
+		return cmd.Error("cannot get stdout for session: %v", err2)
+	}
 	command := fmt.Sprintf("sudo /usr/bin/scp -f %s", remoteFile)
-	if err := sess.Run(command); err != nil {
+	if err := sess.Start(command); err != nil {
 		return cmd.Error("command [%s] for session failed: %v", command, err)
 	}
-	return nil
-}
-
-func downloadInternScp(r io.Reader, w io.Writer) (err *cmd.XbeeError) {
-	buf := make([]byte, 1)
-	if _, err2 := r.Read(buf); err2 != nil {
-		err = cmd.Error("error reading from remote: %v", err2)
-		return
+	err = downloadInternScp(r, f, w)
+	if err2 := w.Close(); err2 != nil && err == nil {
+		err = cmd.Error("cannot close writer: %v", err2)
 	}
-
-	for {
-		_, err2 := r.Read(buf)
-		if err2 != nil {
-			err = cmd.Error("error reading from remote: %v", err2)
-			return
-		}
-		if buf[0] == 'C' {
-			break
-		}
+	if err2 := sess.Wait(); err2 != nil && err == nil {
+		err = cmd.Error("command [%s] for session failed: %v", command, err2)
 	}
+	return
+}
 
-	_, err2 := fmt.Fscanln(r)
+// downloadInternScp is the sink side of the scp protocol, for a single file.
+func downloadInternScp(r io.Reader, w io.Writer, ack io.Writer) *cmd.XbeeError {
+	br := bufio.NewReader(r)
+	if err := scpAck(ack); err != nil {
+		return err
+	}
+	header, err2 := br.ReadString('\n')
 	if err2 != nil {
-		err = cmd.Error("error reading file details: %v", err2)
-		return
+		return cmd.Error("error reading from remote: %v", err2)
 	}
-
-	_, err3 := io.Copy(w, r)
-	if err3 != nil {
-		err = cmd.Error("error copying data to local file: %v", err3)
+	if header[0] == 1 || header[0] == 2 {
+		return cmd.Error("remote scp failed: %s", strings.TrimSpace(header[1:]))
+	}
+	var mode, name string
+	var size int64
+	if header[0] != 'C' {
+		return cmd.Error("unexpected scp header: %s", strings.TrimSpace(header))
+	}
+	if _, err := fmt.Sscanf(header[1:], "%s %d %s", &mode, &size, &name); err != nil {
+		return cmd.Error("error reading file details: %v", err)
+	}
+	if err := scpAck(ack); err != nil {
 		return err
 	}
+	if _, err := io.CopyN(w, br, size); err != nil {
+		return cmd.Error("error copying data to local file: %v", err)
+	}
+	if status, err := br.ReadByte(); err != nil || status != 0 {
+		return cmd.Error("transfer of %s not terminated properly: %v", name, err)
+	}
+	return scpAck(ack)
+}
 
+func scpAck(w io.Writer) *cmd.XbeeError {
+	if _, err := w.Write([]byte{0}); err != nil {
+		return cmd.Error("cannot acknowledge to remote: %v", err)
+	}
 	return nil
 }
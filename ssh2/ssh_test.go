@@ -0,0 +1,399 @@
+package ssh2
+
+import (
+	"context"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/newfs"
+	"github.com/iodasolutions/xbee-common/provider"
+	"github.com/iodasolutions/xbee-common/ssh2/sshtest"
+	"github.com/iodasolutions/xbee-common/stringutils"
+	"golang.org/x/crypto/ssh"
+)
+
+func connectTo(t *testing.T, s *sshtest.Server) *SSHClient {
+	client, err := ConnectWith(s.Host(), s.Port(), "xbee", s.Keys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func Test_UploadContentAndDownload(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	remote := newfs.NewFolder(t.TempDir()).ChildFolder("remote").ChildFile("a.txt")
+	if err := client.UploadContent("hello\nworld\n", remote); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if remote.Content() != "hello\nworld\n" {
+		t.Errorf("unexpected uploaded content: %q", remote.Content())
+	}
+	local := newfs.NewFolder(t.TempDir())
+	if err := client.Download(remote, local); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content := local.ChildFile("a.txt").Content(); content != "hello\nworld\n" {
+		t.Errorf("unexpected downloaded content: %q", content)
+	}
+}
+
+func Test_UploadFile(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	f := newfs.NewFolder(t.TempDir()).ChildFile("b.txt")
+	f.SetContent("b")
+	todir := newfs.NewFolder(t.TempDir())
+	if err := client.UploadFile(f, todir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content := todir.ChildFile("b.txt").Content(); content != "b" {
+		t.Errorf("unexpected uploaded content: %q", content)
+	}
+}
+
+func Test_RemoteCommand(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	dir := t.TempDir()
+	result, err := client.NewCommand(`pwd; echo "$GREETING"; echo oops >&2; exit 3`).
+		WithDirectory(dir).
+		WithEnv([]string{"GREETING=it's me"}).
+		Quiet().
+		Run(context.Background())
+	if err == nil {
+		t.Errorf("expected an error for exit status 3")
+	}
+	if result.ExitStatus != 3 {
+		t.Errorf("expected exit status 3, actual is %d", result.ExitStatus)
+	}
+	if result.Stdout != dir+"\nit's me\n" {
+		t.Errorf("unexpected stdout: %q", result.Stdout)
+	}
+	if result.Stderr != "oops\n" {
+		t.Errorf("unexpected stderr: %q", result.Stderr)
+	}
+}
+
+func Test_RemoteCommandScripted(t *testing.T) {
+	s := sshtest.NewServer(sshtest.Scripted{
+		"uname -m": {Stdout: "x86_64\n"},
+	}.Handle)
+	defer s.Close()
+	client := connectTo(t, s)
+	out, err := client.RunCommandToOut("uname -m")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "x86_64\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+	if _, err := client.RunCommandToOut("uname -r"); err == nil {
+		t.Errorf("expected an error for an unscripted command")
+	}
+}
+
+func Test_RunScript(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	target := newfs.NewFolder(t.TempDir()).ChildFile("done")
+	if err := client.RunScriptQuiet("echo -n ok > " + target.String()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target.Content() != "ok" {
+		t.Errorf("script did not run, content is %q", target.Content())
+	}
+}
+
+func Test_LocalForward(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		conn, err := echo.Accept()
+		if err == nil {
+			_, _ = io.Copy(conn, conn)
+			conn.Close()
+		}
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	tunnel, err2 := client.LocalForward(ctx, "", echo.Addr().String())
+	if err2 != nil {
+		t.Fatalf("unexpected error: %v", err2)
+	}
+	if tunnel.Port() == 0 {
+		t.Errorf("expected a bound port")
+	}
+	conn, err := net.Dial("tcp", tunnel.Addr())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _ = conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("unexpected echo %q: %v", buf, err)
+	}
+	defer cancel()
+	// Stop closes connections still open
+	defer conn.Close()
+	if err := tunnel.Stop(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	select {
+	case <-tunnel.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("tunnel not done after Stop with a live connection")
+	}
+	if _, err := conn.Read(buf); err == nil {
+		t.Errorf("expected connection closed by Stop")
+	}
+}
+
+func Test_LocalForwardHalfClose(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer server.Close()
+	go func() {
+		conn, err := server.Accept()
+		if err == nil {
+			// answers once the whole request is read
+			request, _ := io.ReadAll(conn)
+			_, _ = conn.Write([]byte("answer to " + string(request)))
+			conn.Close()
+		}
+	}()
+	tunnel, err2 := client.LocalForward(context.Background(), "", server.Addr().String())
+	if err2 != nil {
+		t.Fatalf("unexpected error: %v", err2)
+	}
+	defer tunnel.Stop()
+	conn, err := net.Dial("tcp", tunnel.Addr())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("request"))
+	_ = conn.(*net.TCPConn).CloseWrite()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if answer, err := io.ReadAll(conn); err != nil || string(answer) != "answer to request" {
+		t.Errorf("unexpected answer %q: %v", answer, err)
+	}
+}
+
+func Test_DynamicForwardWithoutNoAuthMethod(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	tunnel, err := client.DynamicForward(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+	conn, err2 := net.Dial("tcp", tunnel.Addr())
+	if err2 != nil {
+		t.Fatalf("unexpected error: %v", err2)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte{5, 1, 2}) // username/password only
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[0] != 5 || reply[1] != 0xFF {
+		t.Errorf("expected no acceptable method reply, actual is %v: %v", reply, err)
+	}
+}
+
+func Test_FanOutCanary(t *testing.T) {
+	s := sshtest.NewServer(sshtest.Scripted{"hostname": {ExitStatus: 1}}.Handle)
+	defer s.Close()
+	hosts := provider.InstanceInfos{
+		{Name: "a", ExternalIp: s.Host(), SSHPort: s.Port(), User: "xbee"},
+		{Name: "b", ExternalIp: s.Host(), SSHPort: s.Port(), User: "xbee"},
+	}
+	results, err := NewFanOut(hosts).WithKeys(s.Keys).WithCanary("b").RunCommand(context.Background(), "hostname")
+	if err == nil {
+		t.Errorf("expected an error from canary host")
+	}
+	if len(results) != 2 || results[0].Host != "b" || !results[1].Skipped {
+		t.Errorf("unexpected results:\n%s", results)
+	}
+	if len(s.Commands()) != 1 {
+		t.Errorf("only canary host should have run, commands are %v", s.Commands())
+	}
+}
+
+func Test_FanOutFromOptions(t *testing.T) {
+	var fo *FanOut
+	root := cmd.NewCommand("root")
+	run := cmd.NewCommand("run").WithRunE(func(ctx context.Context, _ []string) *cmd.XbeeError {
+		var err *cmd.XbeeError
+		fo, err = NewFanOutFromOptions(ctx, nil)
+		return err
+	})
+	run.Options = FanOutOptions()
+	_ = root.AddCommands(run)
+	app := cmd.NewApp(root)
+	if err := app.Execute(context.Background(), []string{"run", "--parallel", "2", "--parallel", "4", "--batch", "3"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fo.concurrency != 4 || fo.batch != 3 {
+		t.Errorf("expected concurrency 4 and batch 3, actual are %d and %d", fo.concurrency, fo.batch)
+	}
+	for _, args := range [][]string{{"run", "--parallel", "x"}, {"run", "--parallel", "0"}} {
+		if err := app.Execute(context.Background(), args); err == nil || err.Category() != cmd.CategoryUsage {
+			t.Errorf("expected a usage error for %v, actual is %v", args, err)
+		}
+	}
+}
+
+func Test_DryRun(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	target := newfs.NewFolder(t.TempDir()).ChildFile("created")
+	var planned []string
+	root := cmd.NewCommand("root")
+	_ = root.AddCommands(cmd.NewCommand("run").WithRunE(func(ctx context.Context, _ []string) *cmd.XbeeError {
+		if _, err := client.NewCommand("touch " + target.String()).Quiet().Run(ctx); err != nil {
+			return err
+		}
+		if _, err := client.Facts(ctx); err != nil {
+			return err
+		}
+		// no server listens on port 1 : hosts are not connected in dry run
+		unreachable := provider.InstanceInfos{{Name: "a", ExternalIp: "127.0.0.1", SSHPort: "1", User: "xbee"}}
+		if _, err := NewFanOut(unreachable).RunCommand(ctx, "reboot"); err != nil {
+			return err
+		}
+		planned = cmd.PlannedActions(ctx)
+		return nil
+	}))
+	app := cmd.NewApp(root)
+	var out strings.Builder
+	app.Stdout = &out
+	if err := app.Execute(context.Background(), []string{"--dry-run", "run"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target.Exists() {
+		t.Errorf("remote command run in dry run")
+	}
+	if len(s.Commands()) != 1 {
+		t.Errorf("expected only the read only facts command, actual commands are %v", s.Commands())
+	}
+	if len(planned) != 2 || !strings.HasPrefix(planned[0], "run touch ") || planned[1] != "run reboot on a" {
+		t.Errorf("unexpected planned actions %q", planned)
+	}
+}
+
+func Test_EnsureFile(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	ctx := context.Background()
+	f := newfs.NewFolder(t.TempDir()).ChildFile("my app.conf") // a path with a space
+	f.SetContent("port=80\n")
+
+	result, err := client.EnsureFile(f).DryRun().Template(ctx, "port={{ .port }}\n", map[string]interface{}{"port": 8080}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Changed || !strings.Contains(result.Diff, "-port=80\n+port=8080\n") || f.Content() != "port=80\n" {
+		t.Errorf("unexpected dry run result %+v, content is %q", result, f.Content())
+	}
+	for i, expected := range []bool{true, false} {
+		result, err = client.EnsureFile(f).WithMode(0600).WithBackup().Content(ctx, "port=8080\n")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Changed != expected {
+			t.Errorf("run %d: expected changed to be %v", i, expected)
+		}
+	}
+	if f.Content() != "port=8080\n" || f.Mod().Perm() != 0600 {
+		t.Errorf("unexpected file %q with mode %o", f.Content(), f.Mod().Perm())
+	}
+
+	if _, err := client.EnsureFile(f).Section(ctx, "user=xbee\n"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	section, other, _, _ := stringutils.ExtractSection(f.Content())
+	if section != "user=xbee\n" || other != "port=8080\n" {
+		t.Errorf("unexpected content %q", f.Content())
+	}
+}
+
+func Test_Facts(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	facts, err := client.Facts(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if facts.Arch != runtime.GOARCH || facts.CPUs == 0 || facts.MemoryBytes == 0 || facts.Kernel == "" {
+		t.Errorf("unexpected facts %+v", facts)
+	}
+	if err := facts.CheckOsArch("linux_" + runtime.GOARCH); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if again, _ := client.Facts(context.Background()); again != facts || len(s.Commands()) != 1 {
+		t.Errorf("facts should be cached")
+	}
+}
+
+func Test_ServerRejectsSecondExecAndSubsystems(t *testing.T) {
+	s := sshtest.NewServer(sshtest.ShellHandler)
+	defer s.Close()
+	client := connectTo(t, s)
+	channel, requests, err := client.OpenChannel("session", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+	exec := func(command string) bool {
+		ok, err := channel.SendRequest("exec", true, ssh.Marshal(struct{ Command string }{command}))
+		return err == nil && ok
+	}
+	if !exec("sleep 1") {
+		t.Fatalf("first exec must be accepted")
+	}
+	done := make(chan bool)
+	go func() { done <- exec("echo again") }()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Errorf("second exec must be rejected")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second exec blocked")
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer session.Close()
+	if err := session.RequestSubsystem("sftp"); err == nil {
+		t.Errorf("sftp subsystem must be rejected")
+	}
+}
@@ -0,0 +1,57 @@
+package sshtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// ShellHandler runs commands with the local sh, as the user running the tests.
+// A leading sudo without options is dropped.
+func ShellHandler(ctx context.Context, e *Exec) int {
+	aCmd := exec.CommandContext(ctx, "sh", "-c", stripSudo(e.Command))
+	aCmd.Cancel = func() error {
+		return aCmd.Process.Signal(syscall.SIGTERM)
+	}
+	aCmd.Env = append(os.Environ(), e.Env...)
+	aCmd.Stdin = e.Stdin
+	aCmd.Stdout = e.Stdout
+	aCmd.Stderr = e.Stderr
+	err := aCmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr) && exitErr.ExitCode() != -1:
+		return exitErr.ExitCode()
+	case errors.As(err, &exitErr): // killed by a signal
+		return 128 + int(exitErr.Sys().(syscall.WaitStatus).Signal())
+	default:
+		fmt.Fprintf(e.Stderr, "sh: %v\n", err)
+		return 127
+	}
+}
+
+// Reply is the canned answer of a Scripted handler.
+type Reply struct {
+	Stdout     string
+	Stderr     string
+	ExitStatus int
+}
+
+// Scripted answers commands with canned replies. Unknown commands fail with status 127.
+type Scripted map[string]Reply
+
+func (s Scripted) Handle(_ context.Context, e *Exec) int {
+	reply, ok := s[e.Command]
+	if !ok {
+		fmt.Fprintf(e.Stderr, "sshtest: no reply scripted for [%s]\n", e.Command)
+		return 127
+	}
+	fmt.Fprint(e.Stdout, reply.Stdout)
+	fmt.Fprint(e.Stderr, reply.Stderr)
+	return reply.ExitStatus
+}
@@ -0,0 +1,121 @@
+package sshtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func isScp(command string) bool {
+	fields := strings.Fields(stripSudo(command))
+	return len(fields) > 2 && filepath.Base(fields[0]) == "scp"
+}
+
+// serveScp implements the remote side of scp for single regular files : -t (sink) and -f (source).
+func serveScp(e *Exec) int {
+	fields := strings.Fields(stripSudo(e.Command))
+	target := fields[len(fields)-1]
+	for _, flag := range fields[1 : len(fields)-1] {
+		if strings.HasPrefix(flag, "-") && strings.Contains(flag, "t") {
+			return scpSink(e, target)
+		}
+		if strings.HasPrefix(flag, "-") && strings.Contains(flag, "f") {
+			return scpSource(e, target)
+		}
+	}
+	return scpFailed(e, "unsupported scp command %s", e.Command)
+}
+
+func scpSink(e *Exec, target string) int {
+	br := bufio.NewReader(e.Stdin)
+	scpAck(e)
+	for {
+		header, err := br.ReadString('\n')
+		if err == io.EOF && header == "" {
+			return 0
+		}
+		if err != nil {
+			return scpFailed(e, "cannot read header : %v", err)
+		}
+		var mode, name string
+		var size int64
+		if header[0] != 'C' {
+			return scpFailed(e, "unsupported header %s", strings.TrimSpace(header))
+		}
+		// names may contain spaces
+		parts := strings.SplitN(strings.TrimSuffix(header[1:], "\n"), " ", 3)
+		if len(parts) != 3 {
+			return scpFailed(e, "cannot parse header %s", strings.TrimSpace(header))
+		}
+		mode, name = parts[0], parts[2]
+		size, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return scpFailed(e, "cannot parse size of header %s : %v", strings.TrimSpace(header), err)
+		}
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return scpFailed(e, "bad mode %s", mode)
+		}
+		path := target
+		if fi, err := os.Stat(target); err == nil && fi.IsDir() {
+			path = filepath.Join(target, name)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(perm))
+		if err != nil {
+			return scpFailed(e, "%v", err)
+		}
+		scpAck(e)
+		_, err = io.CopyN(f, br, size)
+		_ = f.Close()
+		if err != nil {
+			return scpFailed(e, "cannot write %s : %v", path, err)
+		}
+		if status, err := br.ReadByte(); err != nil || status != 0 {
+			return scpFailed(e, "transfer of %s not terminated properly", path)
+		}
+		scpAck(e)
+	}
+}
+
+func scpSource(e *Exec, path string) int {
+	br := bufio.NewReader(e.Stdin)
+	if !scpWaitAck(br) {
+		return 1
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return scpFailed(e, "%v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return scpFailed(e, "%v", err)
+	}
+	fmt.Fprintf(e.Stdout, "C%04o %d %s\n", fi.Mode().Perm(), len(content), filepath.Base(path))
+	if !scpWaitAck(br) {
+		return 1
+	}
+	_, _ = e.Stdout.Write(content)
+	scpAck(e)
+	if !scpWaitAck(br) {
+		return 1
+	}
+	return 0
+}
+
+func scpAck(e *Exec) {
+	_, _ = e.Stdout.Write([]byte{0})
+}
+
+func scpWaitAck(br *bufio.Reader) bool {
+	b, err := br.ReadByte()
+	return err == nil && b == 0
+}
+
+func scpFailed(e *Exec, format string, args ...interface{}) int {
+	fmt.Fprintf(e.Stdout, "\x01scp: %s\n", fmt.Sprintf(format, args...))
+	return 1
+}
@@ -0,0 +1,256 @@
+// Package sshtest provides an in-process SSH server, to test code built on ssh2 without a real sshd.
+package sshtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/newfs"
+	"golang.org/x/crypto/ssh"
+)
+
+// Exec describes a command received by the server.
+type Exec struct {
+	Command string
+	Env     []string
+	Pty     bool
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+// Handler executes a command and returns its exit status. ctx is cancelled when the client sends a signal or disconnects.
+type Handler func(ctx context.Context, e *Exec) int
+
+// Server accepts connections authenticated with the xbee key of Keys. scp commands are served by the server itself,
+// other commands are given to the handler. File transfer is only supported through scp, as ssh2 does : subsystem
+// requests, sftp included, are rejected.
+type Server struct {
+	Keys *newfs.RsaGenerator
+
+	listener net.Listener
+	config   *ssh.ServerConfig
+	handler  Handler
+	keysDir  newfs.Folder
+
+	lock     sync.Mutex
+	commands []string
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server listening on a random port of the loopback interface, with a fresh xbee key.
+// It panics on failure, as servers are only created by tests.
+func NewServer(handler Handler) *Server {
+	dir, err := os.MkdirTemp("", "sshtest")
+	if err != nil {
+		panic(cmd.Error("cannot create temporary folder : %v", err))
+	}
+	s := &Server{
+		handler: handler,
+		keysDir: newfs.NewFolder(dir),
+		Keys:    newfs.NewRsaGen(newfs.NewFolder(dir).ChildFolder(".ssh")),
+	}
+	s.Keys.EnsureRootKeysExist(context.Background())
+	authorized, _, _, _, err := ssh.ParseAuthorizedKey(s.Keys.RootAuthorizedKey().ContentBytes())
+	if err != nil {
+		panic(cmd.Error("cannot parse xbee public key : %v", err))
+	}
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown public key")
+		},
+	}
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(cmd.Error("cannot generate host key : %v", err))
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		panic(cmd.Error("cannot create host key signer : %v", err))
+	}
+	s.config.AddHostKey(signer)
+	if s.listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		panic(cmd.Error("cannot listen : %v", err))
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host
+}
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+// Commands returns the commands received so far, in order, including scp ones.
+func (s *Server) Commands() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Close stops the server and deletes its keys.
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+	_ = s.keysDir.Delete()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	sConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	defer sConn.Close()
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go s.handleSession(newChannel)
+		case "direct-tcpip":
+			go handleDirectTcpip(newChannel)
+		default:
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+func (s *Server) handleSession(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := &Exec{Stdin: channel, Stdout: channel, Stderr: channel.Stderr()}
+	started := make(chan bool, 1)
+	go func() {
+		defer close(started)
+		var execReceived bool
+		for req := range requests {
+			switch req.Type {
+			case "env":
+				var kv struct{ Key, Value string }
+				_ = ssh.Unmarshal(req.Payload, &kv)
+				e.Env = append(e.Env, kv.Key+"="+kv.Value)
+				_ = req.Reply(true, nil)
+			case "pty-req":
+				e.Pty = true
+				_ = req.Reply(true, nil)
+			case "exec", "shell":
+				if execReceived {
+					// a session runs a single command
+					_ = req.Reply(false, nil)
+					continue
+				}
+				execReceived = true
+				var payload struct{ Command string }
+				if req.Type == "exec" {
+					_ = ssh.Unmarshal(req.Payload, &payload)
+				}
+				e.Command = payload.Command
+				_ = req.Reply(true, nil)
+				started <- true
+			case "signal":
+				cancel()
+			default:
+				_ = req.Reply(false, nil)
+			}
+		}
+		cancel()
+	}()
+	if _, ok := <-started; !ok {
+		return
+	}
+	s.lock.Lock()
+	s.commands = append(s.commands, e.Command)
+	s.lock.Unlock()
+
+	var status int
+	if isScp(e.Command) {
+		status = serveScp(e)
+	} else {
+		status = s.handler(ctx, e)
+	}
+	_ = channel.CloseWrite()
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(status))
+	_, _ = channel.SendRequest("exit-status", false, payload)
+}
+
+func handleDirectTcpip(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+	if err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer conn.Close()
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+	// each direction is half closed at its end, so that a client half closing still gets the answer
+	copied := make(chan bool, 2)
+	go func() {
+		_, _ = io.Copy(conn, channel)
+		_ = conn.(*net.TCPConn).CloseWrite()
+		copied <- true
+	}()
+	go func() {
+		_, _ = io.Copy(channel, conn)
+		_ = channel.CloseWrite()
+		copied <- true
+	}()
+	<-copied
+	<-copied
+}
+
+// stripSudo removes a leading sudo without options, since tests run as the current user.
+func stripSudo(command string) string {
+	if rest, ok := strings.CutPrefix(command, "sudo "); ok && !strings.HasPrefix(rest, "-") {
+		return rest
+	}
+	return command
+}
@@ -0,0 +1,306 @@
+package ssh2
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/iodasolutions/xbee-common/cmd"
+	"github.com/iodasolutions/xbee-common/log2"
+)
+
+const defaultLocalAddr = "127.0.0.1:0"
+
+// Tunnel is a running port forwarding. It stops when Stop is called, when its context is done or when the connection is closed.
+type Tunnel struct {
+	kind     string
+	listener net.Listener
+	dial     func(network string, addr string) (net.Conn, error)
+	target   func(conn net.Conn) (string, *cmd.XbeeError)
+
+	stopOnce sync.Once
+	cancel   context.CancelFunc
+	conns    sync.WaitGroup
+	mu       sync.Mutex
+	open     map[net.Conn]struct{} // accepted connections, closed by Stop
+	done     chan struct{}
+}
+
+// LocalForward listens on localAddr and forwards each connection to remoteAddr, as seen from the remote host (ssh -L).
+// An empty localAddr binds a random port on the loopback interface.
+func (hr *SSHClient) LocalForward(ctx context.Context, localAddr string, remoteAddr string) (*Tunnel, *cmd.XbeeError) {
+	if localAddr == "" {
+		localAddr = defaultLocalAddr
+	}
+	l, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, cmd.Error("cannot listen on %s : %v", localAddr, err)
+	}
+	t := &Tunnel{
+		kind:     "local",
+		listener: l,
+		dial:     hr.Dial,
+		target:   func(net.Conn) (string, *cmd.XbeeError) { return remoteAddr, nil },
+	}
+	return t.start(ctx), nil
+}
+
+// RemoteForward listens on remoteAddr on the remote host and forwards each connection to localAddr (ssh -R).
+func (hr *SSHClient) RemoteForward(ctx context.Context, remoteAddr string, localAddr string) (*Tunnel, *cmd.XbeeError) {
+	l, err := hr.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, cmd.Error("cannot listen on %s on remote host %s : %v", remoteAddr, hr.RemoteAddr(), err)
+	}
+	t := &Tunnel{
+		kind:     "remote",
+		listener: l,
+		dial:     (&net.Dialer{}).Dial,
+		target:   func(net.Conn) (string, *cmd.XbeeError) { return localAddr, nil },
+	}
+	return t.start(ctx), nil
+}
+
+// DynamicForward starts a SOCKS5 proxy on localAddr, whose connections are opened from the remote host (ssh -D).
+// Only the CONNECT command without authentication is supported.
+func (hr *SSHClient) DynamicForward(ctx context.Context, localAddr string) (*Tunnel, *cmd.XbeeError) {
+	if localAddr == "" {
+		localAddr = defaultLocalAddr
+	}
+	l, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, cmd.Error("cannot listen on %s : %v", localAddr, err)
+	}
+	t := &Tunnel{
+		kind:     "socks",
+		listener: l,
+		dial:     hr.Dial,
+		target:   socks5Handshake,
+	}
+	return t.start(ctx), nil
+}
+
+// Addr returns the address the tunnel listens on. For a remote forwarding, it is an address of the remote host.
+func (t *Tunnel) Addr() string {
+	return t.listener.Addr().String()
+}
+
+// Port returns the bound port, useful when a random port was requested.
+func (t *Tunnel) Port() int {
+	_, port, _ := net.SplitHostPort(t.Addr())
+	result, _ := strconv.Atoi(port)
+	return result
+}
+
+// Done is closed once the tunnel is stopped and all its connections are closed.
+func (t *Tunnel) Done() <-chan struct{} {
+	return t.done
+}
+
+// Stop closes the listener and all connections in progress.
+func (t *Tunnel) Stop() (err *cmd.XbeeError) {
+	t.stopOnce.Do(func() {
+		if err2 := t.listener.Close(); err2 != nil && err2 != io.EOF {
+			err = cmd.Error("cannot close %s tunnel on %s : %v", t.kind, t.Addr(), err2)
+		}
+		t.cancel()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for conn := range t.open {
+			_ = conn.Close()
+		}
+		t.open = nil
+	})
+	return
+}
+
+// track registers conn to be closed by Stop, and returns false if the tunnel is already stopped.
+func (t *Tunnel) track(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.open == nil {
+		return false
+	}
+	t.open[conn] = struct{}{}
+	return true
+}
+
+func (t *Tunnel) untrack(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.open, conn)
+}
+
+func (t *Tunnel) start(ctx context.Context) *Tunnel {
+	t.done = make(chan struct{})
+	if ctx == nil {
+		ctx = cmd.Context()
+	}
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.open = make(map[net.Conn]struct{})
+	go func() {
+		<-ctx.Done()
+		if err := t.Stop(); err != nil {
+			log2.Debugf("%v", err)
+		}
+	}()
+	go func() {
+		defer close(t.done)
+		for {
+			conn, err := t.listener.Accept()
+			if err != nil {
+				break
+			}
+			if !t.track(conn) {
+				_ = conn.Close()
+				break
+			}
+			t.conns.Add(1)
+			go t.forward(ctx, conn)
+		}
+		_ = t.Stop()
+		t.conns.Wait()
+	}()
+	log2.Debugf("%s tunnel listening on %s", t.kind, t.Addr())
+	return t
+}
+
+func (t *Tunnel) forward(ctx context.Context, conn net.Conn) {
+	defer t.conns.Done()
+	defer t.untrack(conn)
+	defer conn.Close()
+	addr, err := t.target(conn)
+	if err != nil {
+		log2.Warnf("%s tunnel on %s : %v", t.kind, t.Addr(), err)
+		return
+	}
+	peer, err2 := t.dial("tcp", addr)
+	if t.kind == "socks" {
+		if err2 != nil {
+			socksReply(conn, socksUnreachable)
+		} else {
+			socksReply(conn, socksSucceeded)
+		}
+	}
+	if err2 != nil {
+		log2.Warnf("%s tunnel on %s cannot reach %s : %v", t.kind, t.Addr(), addr, err2)
+		return
+	}
+	defer peer.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+		peer.Close()
+	})
+	defer stop()
+	var copies sync.WaitGroup
+	copies.Add(2)
+	go pipe(&copies, peer, conn)
+	go pipe(&copies, conn, peer)
+	copies.Wait()
+}
+
+// closeWriter is implemented by TCP connections and SSH channels, which can be half closed.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe copies src to dst. At the end of src, dst is half closed, so that data still flowing the other way
+// is delivered ; on error, both are closed.
+func pipe(copies *sync.WaitGroup, dst net.Conn, src net.Conn) {
+	defer copies.Done()
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = src.Close()
+		return
+	}
+	if cw, ok := dst.(closeWriter); ok {
+		_ = cw.CloseWrite()
+	} else {
+		_ = dst.Close()
+	}
+}
+
+const (
+	socksVersion     = 5
+	socksNoAuth      = 0
+	socksConnect     = 1
+	socksIPv4        = 1
+	socksDomain      = 3
+	socksIPv6        = 4
+	socksSucceeded   = 0
+	socksNoMethod    = 0xFF
+	socksUnreachable = 4
+	socksUnsupported = 7
+	socksBadAddress  = 8
+)
+
+// socks5Handshake reads a SOCKS5 CONNECT request (RFC 1928) and returns the requested address.
+// The final reply is sent by the tunnel once the address is dialed.
+func socks5Handshake(conn net.Conn) (string, *cmd.XbeeError) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", cmd.Error("cannot read socks greeting : %v", err)
+	}
+	if header[0] != socksVersion {
+		return "", cmd.Error("unsupported socks version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", cmd.Error("cannot read socks methods : %v", err)
+	}
+	if !bytes.Contains(methods, []byte{socksNoAuth}) {
+		_, _ = conn.Write([]byte{socksVersion, socksNoMethod})
+		return "", cmd.Error("socks client does not offer the no authentication method, offered are %v", methods)
+	}
+	if _, err := conn.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return "", cmd.Error("cannot answer socks greeting : %v", err)
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", cmd.Error("cannot read socks request : %v", err)
+	}
+	if request[1] != socksConnect {
+		socksReply(conn, socksUnsupported)
+		return "", cmd.Error("unsupported socks command %d", request[1])
+	}
+	var host string
+	switch request[3] {
+	case socksIPv4, socksIPv6:
+		ip := make([]byte, net.IPv4len)
+		if request[3] == socksIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", cmd.Error("cannot read socks address : %v", err)
+		}
+		host = net.IP(ip).String()
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", cmd.Error("cannot read socks address : %v", err)
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", cmd.Error("cannot read socks address : %v", err)
+		}
+		host = string(domain)
+	default:
+		socksReply(conn, socksBadAddress)
+		return "", cmd.Error("unsupported socks address type %d", request[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", cmd.Error("cannot read socks port : %v", err)
+	}
+	return net.JoinHostPort(host, fmt.Sprint(binary.BigEndian.Uint16(port))), nil
+}
+
+// socksReply answers with an unspecified bound address, which clients ignore for CONNECT.
+func socksReply(conn net.Conn, status byte) {
+	_, _ = conn.Write([]byte{socksVersion, status, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+}
@@ -39,14 +39,14 @@ func CloneNode(n *yaml.Node) *yaml.Node {
 func LoadYamlDocument(f newfs.File) (*yaml.Node, *cmd.XbeeError) {
 	data, err := os.ReadFile(f.String())
 	if err != nil {
-		return nil, cmd.Error("Error reading file", err)
+		return nil, cmd.Error("Error reading file %s : %w", f, err)
 	}
 
 	var doc yaml.Node
 
 	err = yaml.Unmarshal(data, &doc)
 	if err != nil {
-		return nil, cmd.Error("Error parsing yaml2", err)
+		return nil, cmd.Error("Error parsing yaml2 %s : %w", f, err)
 	}
 
 	return &doc, nil